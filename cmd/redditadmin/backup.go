@@ -0,0 +1,105 @@
+package main
+
+import (
+	"cmd/redditclone/pkg/backup"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+func runBackup(ctx context.Context, out *printer, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := fs.String("o", "", "archive file, stdout if empty")
+	withSessions := fs.Bool("sessions", false, "include active sessions (they are credentials)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	src := backup.Source{
+		UserRepo:  open().Users,
+		ItemsRepo: open().Items,
+		Sessions:  open().Sessions,
+	}
+	trailer, err := backup.Backup(ctx, w, src, *withSessions)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		// архив ушел в stdout, сводку туда писать нельзя
+		return nil
+	}
+	return printCounts(out, trailer.Counts)
+}
+
+func runRestore(ctx context.Context, out *printer, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := fs.String("i", "", "archive file")
+	withSessions := fs.Bool("sessions", false, "restore sessions stored in the archive")
+	verifyOnly := fs.Bool("verify-only", false, "only check the archive, do not write anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		// архив читается дважды: сначала проверка, потом запись
+		return fmt.Errorf("usage: restore -i <file> [-sessions] [-verify-only]")
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	manifest, err := backup.Verify(f)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", *input, err)
+	}
+	if *verifyOnly {
+		return printCounts(out, manifest.Trailer.Counts)
+	}
+	if *withSessions && !manifest.Header.Sessions {
+		return fmt.Errorf("archive %s was made without sessions", *input)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	target := backup.Target{
+		UserRepo:  open().Users,
+		ItemsRepo: open().Items,
+	}
+	if *withSessions {
+		target.Sessions = open().Sessions
+	}
+	restored, err := backup.Restore(ctx, f, target)
+	if err != nil {
+		return err
+	}
+	return printCounts(out, restored)
+}
+
+func printCounts(out *printer, counts map[string]int) error {
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	rows := make([][]string, 0, len(kinds))
+	for _, kind := range kinds {
+		rows = append(rows, []string{kind, strconv.Itoa(counts[kind])})
+	}
+	return out.print([]string{"KIND", "RECORDS"}, rows, counts)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"cmd/redditclone/pkg/config"
+	"cmd/redditclone/pkg/storage"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `redditadmin - администрирование redditclone
+
+Usage:
+  redditadmin [-format table|json] [-config file] [storage flags] <command> <action> [args]
+
+Storage is configured like the server: YAML file, REDDIT_* environment, flags.
+
+Commands:
+  users list
+  users search <substring>
+  users reset-password [-password <new>] <login>
+  users suspend <login>
+  users unsuspend <login>
+  sessions list <login>
+  sessions revoke <login>
+  sessions revoke -token <token>
+  posts remove <post_id>
+  posts restore <post_id>
+  posts recount [post_id]
+  backup [-o file] [-sessions]
+  restore -i <file> [-sessions] [-verify-only]
+  seed [-users N] [-posts N] [-comments N] [-seed S] [-password P] [-now RFC3339]
+`
+
+// команды без обязательного действия
+var singleArg = map[string]bool{"seed": true, "backup": true, "restore": true}
+
+func main() {
+	format := flag.String("format", "table", "output format: table or json")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	var err error
+	if cfg, err = config.Load(flag.CommandLine, os.Args[1:]); err != nil {
+		fail(err)
+	}
+
+	if *format != "table" && *format != "json" {
+		fail(fmt.Errorf("unknown format %q", *format))
+	}
+	args := flag.Args()
+	if len(args) == 0 || (len(args) < 2 && !singleArg[args[0]]) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	out := &printer{format: *format, w: os.Stdout}
+	switch args[0] {
+	case "users":
+		err = runUsers(ctx, out, args[1], args[2:])
+	case "sessions":
+		err = runSessions(ctx, out, args[1], args[2:])
+	case "posts":
+		err = runPosts(ctx, out, args[1], args[2:])
+	case "seed":
+		err = runSeed(ctx, out, args[1:])
+	case "backup":
+		err = runBackup(ctx, out, args[1:])
+	case "restore":
+		err = runRestore(ctx, out, args[1:])
+	default:
+		err = fmt.Errorf("unknown command %q", args[0])
+	}
+	if backend != nil {
+		if cerr := backend.Close(context.Background()); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+var (
+	cfg     *config.Config
+	backend *storage.Backend
+)
+
+// open подключается к хранилищам при первом обращении: usage и ошибки флагов не требуют базы.
+func open() *storage.Backend {
+	if backend == nil {
+		b, err := storage.Open(context.Background(), cfg.Storage)
+		if err != nil {
+			fail(err)
+		}
+		backend = b
+	}
+	return backend
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "redditadmin:", err)
+	os.Exit(1)
+}
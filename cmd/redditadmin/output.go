@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+// print выводит rows таблицей или value в JSON - в зависимости от формата.
+func (p *printer) print(headers []string, rows [][]string, value interface{}) error {
+	if p.format == "json" {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) message(text string, value interface{}) error {
+	if p.format == "json" {
+		return json.NewEncoder(p.w).Encode(value)
+	}
+	_, err := fmt.Fprintln(p.w, text)
+	return err
+}
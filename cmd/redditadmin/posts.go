@@ -0,0 +1,70 @@
+package main
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"context"
+	"fmt"
+	"strconv"
+)
+
+type postRecord struct {
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	Author           string `json:"author"`
+	Category         string `json:"category"`
+	Score            int    `json:"score"`
+	Votes            int    `json:"votes"`
+	UpvotePercentage int    `json:"upvotePercentage"`
+	Removed          bool   `json:"removed"`
+}
+
+func runPosts(ctx context.Context, out *printer, action string, args []string) error {
+	repo := open().Items
+	switch action {
+	case "remove", "restore":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: posts %s <post_id>", action)
+		}
+		post, ok := repo.SetRemoved(ctx, args[0], action == "remove")
+		if !ok {
+			return fmt.Errorf("post %s not found", args[0])
+		}
+		return printPosts(out, []*posts.Post{post})
+	case "recount":
+		var ids []string
+		if len(args) > 0 {
+			ids = args
+		} else {
+			for _, post := range repo.AllPosts(ctx) {
+				ids = append(ids, post.ID)
+			}
+		}
+		recounted := make([]*posts.Post, 0, len(ids))
+		for _, id := range ids {
+			post, ok := repo.RecountVotes(ctx, id)
+			if !ok {
+				return fmt.Errorf("post %s not found", id)
+			}
+			recounted = append(recounted, post)
+		}
+		return printPosts(out, recounted)
+	}
+	return fmt.Errorf("unknown posts action %q", action)
+}
+
+func printPosts(out *printer, items []*posts.Post) error {
+	records := make([]postRecord, 0, len(items))
+	rows := make([][]string, 0, len(items))
+	for _, p := range items {
+		records = append(records, postRecord{
+			ID: p.ID, Title: p.Title, Author: p.Author.Username, Category: p.Category,
+			Score: p.Score, Votes: p.ScoreCount, UpvotePercentage: p.UpvotePercentage, Removed: p.Removed,
+		})
+		rows = append(rows, []string{
+			p.ID, p.Title, p.Author.Username, p.Category,
+			strconv.Itoa(p.Score), strconv.Itoa(p.ScoreCount), strconv.Itoa(p.UpvotePercentage) + "%",
+			strconv.FormatBool(p.Removed),
+		})
+	}
+	return out.print([]string{"ID", "TITLE", "AUTHOR", "CATEGORY", "SCORE", "VOTES", "UPVOTED", "REMOVED"}, rows, records)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"cmd/redditclone/pkg/seed"
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func runSeed(ctx context.Context, out *printer, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	users := fs.Int("users", 20, "number of users to create")
+	postsCount := fs.Int("posts", 100, "number of posts to create")
+	comments := fs.Int("comments", 15, "maximum comments per post")
+	password := fs.String("password", "password", "password for every generated user")
+	seedValue := fs.Int64("seed", 1, "random seed; the same seed generates the same data")
+	now := fs.String("now", "", "reference time for post dates (RFC3339), defaults to current time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts := seed.Options{
+		Users:       *users,
+		Posts:       *postsCount,
+		MaxComments: *comments,
+		Password:    *password,
+		Seed:        *seedValue,
+	}
+	if *now != "" {
+		t, err := time.Parse(time.RFC3339, *now)
+		if err != nil {
+			return fmt.Errorf("-now: %w", err)
+		}
+		opts.Now = t
+	}
+
+	g := &seed.Generator{
+		UserRepo:  open().Users,
+		ItemsRepo: open().Items,
+	}
+	res, err := g.Run(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return out.print([]string{"USERS", "REUSED USERS", "POSTS", "COMMENTS", "VOTES"},
+		[][]string{{
+			strconv.Itoa(res.Users), strconv.Itoa(res.ReusedUsers),
+			strconv.Itoa(res.Posts), strconv.Itoa(res.Comments), strconv.Itoa(res.Votes),
+		}},
+		res)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type sessionRecord struct {
+	Token     string    `json:"token"`
+	Login     string    `json:"login"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created"`
+	ExpiresAt time.Time `json:"expires"`
+}
+
+func runSessions(ctx context.Context, out *printer, action string, args []string) error {
+	switch action {
+	case "list":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: sessions list <login>")
+		}
+		return listSessions(ctx, out, args[0])
+	case "revoke":
+		return revokeSessions(ctx, out, args)
+	}
+	return fmt.Errorf("unknown sessions action %q", action)
+}
+
+func userID(ctx context.Context, login string) (string, error) {
+	u, err := open().Users.GetUser(ctx, login)
+	if err != nil {
+		return "", fmt.Errorf("user %s: %w", login, err)
+	}
+	return strconv.Itoa(u.ID), nil
+}
+
+func listSessions(ctx context.Context, out *printer, login string) error {
+	id, err := userID(ctx, login)
+	if err != nil {
+		return err
+	}
+	sessions, err := open().Sessions.UserSessions(ctx, id)
+	if err != nil {
+		return err
+	}
+	records := make([]sessionRecord, 0, len(sessions))
+	rows := make([][]string, 0, len(sessions))
+	for _, s := range sessions {
+		records = append(records, sessionRecord{
+			Token: s.Token, Login: s.Login, UserID: s.UserID, CreatedAt: s.CreatedAt, ExpiresAt: s.ExpiresAt,
+		})
+		rows = append(rows, []string{
+			shortToken(s.Token), s.Login, s.CreatedAt.Format(time.RFC3339), s.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	return out.print([]string{"TOKEN", "LOGIN", "CREATED", "EXPIRES"}, rows, records)
+}
+
+func revokeSessions(ctx context.Context, out *printer, args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	token := fs.String("token", "", "revoke a single session by token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	sm := open().Sessions
+	if *token != "" {
+		if err := sm.Destroy(ctx, *token); err != nil {
+			return err
+		}
+		return out.message("session revoked", map[string]string{"token": *token, "status": "revoked"})
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: sessions revoke <login> | sessions revoke -token <token>")
+	}
+	login := fs.Arg(0)
+	id, err := userID(ctx, login)
+	if err != nil {
+		return err
+	}
+	if err = sm.DestroyUser(ctx, id); err != nil {
+		return err
+	}
+	return out.message("all sessions revoked for "+login, map[string]string{"login": login, "status": "revoked"})
+}
+
+func shortToken(token string) string {
+	if len(token) <= 16 {
+		return token
+	}
+	return token[:8] + "…" + token[len(token)-8:]
+}
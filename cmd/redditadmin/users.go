@@ -0,0 +1,115 @@
+package main
+
+import (
+	"cmd/redditclone/pkg/user"
+	"cmd/redditclone/pkg/validate"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+type userRecord struct {
+	ID        int    `json:"id"`
+	Login     string `json:"login"`
+	Suspended bool   `json:"suspended"`
+}
+
+func runUsers(ctx context.Context, out *printer, action string, args []string) error {
+	repo := open().Users
+	switch action {
+	case "list":
+		return listUsers(ctx, out, repo, "")
+	case "search":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: users search <substring>")
+		}
+		return listUsers(ctx, out, repo, args[0])
+	case "reset-password":
+		return resetPassword(ctx, out, repo, args)
+	case "suspend", "unsuspend":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: users %s <login>", action)
+		}
+		return setSuspended(ctx, out, repo, args[0], action == "suspend")
+	}
+	return fmt.Errorf("unknown users action %q", action)
+}
+
+func listUsers(ctx context.Context, out *printer, repo *user.UserMemoryRepository, search string) error {
+	users, err := repo.List(ctx, search)
+	if err != nil {
+		return err
+	}
+	records := make([]userRecord, 0, len(users))
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		records = append(records, userRecord{ID: u.ID, Login: u.Login, Suspended: u.Suspended})
+		rows = append(rows, []string{strconv.Itoa(u.ID), u.Login, strconv.FormatBool(u.Suspended)})
+	}
+	return out.print([]string{"ID", "LOGIN", "SUSPENDED"}, rows, records)
+}
+
+func resetPassword(ctx context.Context, out *printer, repo *user.UserMemoryRepository, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	password := fs.String("password", "", "new password; generated when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: users reset-password [-password <new>] <login>")
+	}
+	login := fs.Arg(0)
+	generated := *password == ""
+	if generated {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		*password = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	// те же требования, что и при регистрации через API
+	if msg := validate.Check(*password, validate.Password()...); msg != "" {
+		return fmt.Errorf("password %s", msg)
+	}
+	if err := repo.SetPassword(ctx, login, *password); err != nil {
+		return err
+	}
+	// старый пароль мог утечь: выданные по нему сессии и refresh-токены больше не действуют
+	if err := revokeUserSessions(ctx, login); err != nil {
+		return err
+	}
+	result := map[string]string{"login": login, "status": "password reset"}
+	text := "password reset for " + login + ", sessions revoked"
+	if generated {
+		result["password"] = *password
+		text += ", new password: " + *password
+	}
+	return out.message(text, result)
+}
+
+// блокировка сразу отзывает все сессии пользователя
+func setSuspended(ctx context.Context, out *printer, repo *user.UserMemoryRepository, login string, suspended bool) error {
+	if err := repo.SetSuspended(ctx, login, suspended); err != nil {
+		return err
+	}
+	status := "unsuspended"
+	if suspended {
+		status = "suspended"
+		if err := revokeUserSessions(ctx, login); err != nil {
+			return err
+		}
+	}
+	return out.message(login+" "+status, map[string]string{"login": login, "status": status})
+}
+
+// revokeUserSessions отзывает все сессии и refresh-токены пользователя.
+func revokeUserSessions(ctx context.Context, login string) error {
+	id, err := userID(ctx, login)
+	if err != nil {
+		return err
+	}
+	return open().Sessions.DestroyUser(ctx, id)
+}
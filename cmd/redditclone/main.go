@@ -1,20 +1,33 @@
 package main
 
 import (
+	"cmd/redditclone/pkg/account"
+	"cmd/redditclone/pkg/config"
+	"cmd/redditclone/pkg/events"
+	"cmd/redditclone/pkg/export"
 	"cmd/redditclone/pkg/handlers"
+	"cmd/redditclone/pkg/keys"
+	"cmd/redditclone/pkg/logging"
+	"cmd/redditclone/pkg/metrics"
 	"cmd/redditclone/pkg/middleware"
+	"cmd/redditclone/pkg/migrate"
 	"cmd/redditclone/pkg/posts"
-	"cmd/redditclone/pkg/session"
-	"cmd/redditclone/pkg/user"
+	"cmd/redditclone/pkg/scheduler"
+	"cmd/redditclone/pkg/storage"
+	"cmd/redditclone/pkg/tracing"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"html/template"
 	"net/http"
-)
-
-const (
-	pathToStaticDir = "static"
-	pathToIndex     = "static/html/index.html"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 )
 
 func main() {
@@ -23,47 +36,188 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer func(zapLogger *zap.Logger) {
-		err = zapLogger.Sync()
+	// Sync на stderr в терминале возвращает EINVAL - это не ошибка записи логов
+	defer zapLogger.Sync()
+	logger := zapLogger.Sugar()
+	// zap.S() - логгер вне запросов, см. logging.FromContext
+	zap.ReplaceGlobals(zapLogger)
+
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if cfg.Storage.Kind != "mysql" {
+			logger.Fatal("Миграции нужны только для MySQL, схема SQLite создается при старте")
+		}
+		db, err := sql.Open("mysql", cfg.Storage.MySQLDSN)
 		if err != nil {
-			panic(err)
+			logger.Fatal(err)
 		}
-	}(zapLogger)
-	logger := zapLogger.Sugar()
-	items := posts.NewMemoryRepo()
+		if err = runMigrate(db, flag.Args()[1:]); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+	if err = cfg.ValidateServer(); err != nil {
+		logger.Fatal(err)
+	}
+
+	archivePolicy, err := posts.ParseArchivePolicy(cfg.ArchiveAge)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	signingKeys, err := keys.Load(keys.Source{
+		Secret:  cfg.JWTSecret,
+		Dir:     cfg.JWTKeysDir,
+		Active:  cfg.JWTActiveKey,
+		Retired: cfg.JWTRetiredKeys,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infof("Токены подписываются ключом %s (%s), ключей для проверки: %d",
+		signingKeys.Active().ID, signingKeys.Active().Algorithm, len(signingKeys.Keys()))
+
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	backend, err := storage.Open(ctx, cfg.Storage)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if cfg.Storage.Kind == "sqlite" {
+		logger.Infof("Данные хранятся в SQLite: %s", cfg.Storage.SQLitePath)
+	}
+	userRepo, sm := backend.Users, backend.Sessions
+	// db.system в спанах репозиториев: mysql, sqlite3 или mongodb
+	dbSystem, postsSystem := backend.DB.Dialect().GetName(), backend.DB.Dialect().GetName()
+	if backend.Mongo != nil {
+		postsSystem = "mongodb"
+	}
+	users := tracing.NewUserRepo(userRepo, dbSystem)
+
+	if cfg.Storage.Migrate && cfg.Storage.Kind == "mysql" {
+		m, err := migrate.New(backend.DB.DB())
+		if err != nil {
+			logger.Fatal(err)
+		}
+		applied, err := m.Up(ctx)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		for _, mig := range applied {
+			logger.Infof("Применена миграция %04d_%s", mig.Version, mig.Name)
+		}
+	}
+
+	hub := events.NewHub(0, 0, 0)
+	items := events.NewPublishingRepo(metrics.NewItemsRepo(tracing.NewItemsRepo(backend.Items, postsSystem)), hub, archivePolicy)
+
+	// фоновые задачи останавливаются отдельно от сервера: после того, как дождались запросов
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	publisher := &scheduler.Publisher{
+		ItemsRepo: items,
+		Logger:    logger,
+		Interval:  scheduler.DefaultPublishInterval,
+	}
+	archiver := &scheduler.Archiver{
+		ItemsRepo: items,
+		Policy:    archivePolicy,
+		Logger:    logger,
+		Interval:  scheduler.DefaultArchiveInterval,
+	}
+	deleter := &account.Deleter{
+		DB:        backend.DB,
+		UserRepo:  users,
+		Sessions:  sm,
+		ItemsRepo: items,
+		Logger:    logger,
+		Interval:  account.DefaultResumeInterval,
+	}
+	jobs.Add(3)
+	go func() {
+		defer jobs.Done()
+		publisher.Run(jobsCtx)
+	}()
+	go func() {
+		defer jobs.Done()
+		archiver.Run(jobsCtx)
+	}()
+	go func() {
+		defer jobs.Done()
+		deleter.Run(jobsCtx)
+	}()
 
-	userRepo := user.NewUserMemoryRepo()
-	sm := session.NewSessionsManager()
 	userHandler := handlers.UserHandler{
-		UserRepo: userRepo,
-		Logger:   logger,
-		Sessions: sm,
+		UserRepo:   metrics.NewUserRepo(users),
+		Sessions:   sm,
+		Deleter:    deleter,
+		Keys:       signingKeys,
+		AccessTTL:  cfg.AccessTokenTTL,
+		RefreshTTL: cfg.RefreshTokenTTL,
+	}
+	exports, err := export.NewManager(users, sm, items, logger, cfg.ExportDir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	exportHandler := &handlers.ExportHandler{
+		Exports: exports,
+	}
+	eventsHandler := &handlers.EventsHandler{
+		Hub:       hub,
+		ItemsRepo: items,
+	}
+	healthHandler := &handlers.HealthHandler{
+		DB:      backend.DB,
+		Mongo:   backend.Mongo,
+		Timeout: cfg.Timeouts.HealthCheck,
+	}
+	feedsHandler := &handlers.FeedsHandler{
+		ItemsRepo: items,
+	}
+	keysHandler := &handlers.KeysHandler{
+		Keys: signingKeys,
 	}
 
 	handlers := &handlers.ItemsHandler{
-		Logger:    logger,
 		ItemsRepo: items,
-		UserRepo:  userRepo,
+		UserRepo:  metrics.NewUserRepo(users),
+		Archive:   archivePolicy,
 	}
 	r := mux.NewRouter()
 
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(pathToStaticDir))))
-	tmpl := template.Must(template.ParseFiles(pathToIndex))
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(cfg.StaticDir))))
+	tmpl := template.Must(template.ParseFiles(cfg.IndexFile))
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		err = tmpl.Execute(w, nil)
-		if err != nil {
-			userHandler.Logger.Error(err)
-			return
+		if err := tmpl.Execute(w, nil); err != nil {
+			logging.FromContext(r.Context()).Error(err)
 		}
 	})
 
+	r.HandleFunc("/healthz", healthHandler.Healthz).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/readyz", healthHandler.Readyz).Methods(http.MethodGet, http.MethodHead)
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	r.HandleFunc("/.well-known/jwks.json", keysHandler.JWKS).Methods(http.MethodGet)
+	r.HandleFunc("/api/ws", eventsHandler.Gateway).Methods(http.MethodGet)
 	r.HandleFunc("/api/login", userHandler.LoginPage)
 	r.HandleFunc("/api/register", userHandler.RegisterPage)
+	r.HandleFunc("/api/token/refresh", userHandler.RefreshToken).Methods(http.MethodPost)
 	// Guest
 	r.HandleFunc("/api/posts/", handlers.Posts).Methods(http.MethodGet)
 	r.HandleFunc("/api/post/{post_id}", handlers.PostInfo).Methods(http.MethodGet)
+	r.HandleFunc("/api/post/{post_id}/events", eventsHandler.PostEvents).Methods(http.MethodGet)
+	r.HandleFunc("/api/post/{post_id}/discussions", handlers.OtherDiscussions).Methods(http.MethodGet)
+	r.HandleFunc("/api/domain/{host}", handlers.DomainPosts).Methods(http.MethodGet)
 	// User
-	r.HandleFunc("/api/posts/{category:music|funny|videos|programming|news|fashion}", handlers.PostsWithCategory).Methods(http.MethodGet)
+	r.HandleFunc("/api/posts/{category:"+strings.Join(posts.Categories, "|")+"}", handlers.PostsWithCategory).Methods(http.MethodGet)
 	r.HandleFunc("/api/posts", handlers.AddPosts).Methods(http.MethodPost)
 	r.HandleFunc("/api/post/{post_id}", handlers.CommentAdd).Methods(http.MethodPost)
 	r.HandleFunc("/api/post/{post_id}/{comment_id}", handlers.CommentDelete).Methods(http.MethodDelete)
@@ -72,13 +226,78 @@ func main() {
 	r.HandleFunc("/api/post/{post_id}/unvote", handlers.PostUnVote).Methods(http.MethodGet)
 	r.HandleFunc("/api/post/{post_id}", handlers.PostDelete).Methods(http.MethodDelete)
 	r.HandleFunc("/api/user/{user_login}", handlers.UserPosts).Methods(http.MethodGet)
+	r.HandleFunc("/api/drafts", handlers.Drafts).Methods(http.MethodGet)
+	r.HandleFunc("/api/drafts", handlers.AddDraft).Methods(http.MethodPost)
+	r.HandleFunc("/api/drafts/{post_id}", handlers.DraftInfo).Methods(http.MethodGet)
+	r.HandleFunc("/api/drafts/{post_id}", handlers.DraftUpdate).Methods(http.MethodPut)
+	r.HandleFunc("/api/drafts/{post_id}", handlers.DraftDelete).Methods(http.MethodDelete)
+	r.HandleFunc("/api/drafts/{post_id}/schedule", handlers.DraftSchedule).Methods(http.MethodPost)
+	r.HandleFunc("/api/drafts/{post_id}/publish", handlers.DraftPublish).Methods(http.MethodPost)
+	r.HandleFunc("/api/me", userHandler.DeleteAccount).Methods(http.MethodDelete)
+	r.HandleFunc("/api/me/export", exportHandler.Start).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/export/{job_id}", exportHandler.Status).Methods(http.MethodGet)
+	r.HandleFunc("/api/me/export/{job_id}/download", exportHandler.Download).Methods(http.MethodGet)
+	// Feeds
+	r.HandleFunc("/feeds/all.atom", feedsHandler.All).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/feeds/{category:"+strings.Join(posts.Categories, "|")+"}.rss", feedsHandler.Category).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/feeds/user/{user_login}.atom", feedsHandler.User).Methods(http.MethodGet, http.MethodHead)
 
-	mux := middleware.Auth(sm, r)
-	mux = middleware.AccessLog(logger, mux)
-	mux = middleware.Panic(logger, mux)
-	err = http.ListenAndServe(":8080", mux)
-	if err != nil {
-		userHandler.Logger.Error(err)
-		return
+	mux := middleware.Auth(sm, signingKeys, cfg.JWTLeeway, r)
+	mux = metrics.Middleware(r, mux)
+	mux = middleware.AccessLog(mux)
+	mux = middleware.Panic(mux)
+	mux = middleware.RequestID(logger, r, mux)
+	// снаружи всех: trace_id нужен логгеру запроса
+	mux = tracing.Middleware(r, mux)
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadTimeout:       cfg.Timeouts.Read,
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		WriteTimeout:      cfg.Timeouts.Write,
+		IdleTimeout:       cfg.Timeouts.Idle,
+		ErrorLog:          zap.NewStdLog(zapLogger),
+	}
+	// Shutdown не ждет hijacked WebSocket и не прерывает SSE - закрываем их через hub
+	srv.RegisterOnShutdown(hub.Close)
+
+	go func() {
+		logger.Infof("Слушаем %s", cfg.Listen)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+	stop()
+	logger.Infof("Останавливаемся, ждем завершения запросов не дольше %s", cfg.Timeouts.Shutdown)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
+	defer cancel()
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Не все запросы завершились: %v", err)
+		srv.Close()
+	}
+
+	stopJobs()
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		// выгрузки читают хранилище - до backend.Close их надо прервать и дождаться
+		exports.Close()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		logger.Error("Фоновые задачи не завершились вовремя")
+	}
+
+	if err = backend.Close(shutdownCtx); err != nil {
+		logger.Error(err)
+	}
+	if err = shutdownTracing(shutdownCtx); err != nil {
+		logger.Errorf("Не удалось дописать трассы: %v", err)
 	}
+	logger.Info("Сервер остановлен")
 }
@@ -0,0 +1,229 @@
+package account
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	ModeAnonymize = "anonymize"
+	ModeRemove    = "remove"
+)
+
+// шаги удаления выполняются строго по порядку, каждый можно безопасно повторить
+const (
+	stepSessions = "sessions"
+	stepVotes    = "votes"
+	stepContent  = "content"
+	stepUser     = "user"
+	stepDone     = "done"
+)
+
+// DefaultResumeInterval - как часто Run подбирает прерванные удаления
+const DefaultResumeInterval = 5 * time.Minute
+
+var steps = []string{stepSessions, stepVotes, stepContent, stepUser, stepDone}
+
+var (
+	ErrBadMode    = errors.New("mode must be anonymize or remove")
+	ErrInProgress = errors.New("account deletion is already in progress")
+)
+
+// Deletion - сохраненное состояние удаления аккаунта, чтобы прерванное удаление
+// можно было продолжить с того же шага.
+type Deletion struct {
+	UserID     string `gorm:"primary_key"`
+	Login      string
+	Mode       string
+	Step       string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+}
+
+func (Deletion) TableName() string {
+	return "account_deletions"
+}
+
+type Deleter struct {
+	DB        *gorm.DB
+	UserRepo  user.UserRepo
+	Sessions  *session.SessionsManager
+	ItemsRepo posts.ItemsRepo
+	Logger    *zap.SugaredLogger
+	Interval  time.Duration
+
+	mu sync.Mutex
+	// running - удаления, которые этот инстанс выполняет прямо сейчас
+	running map[string]bool
+}
+
+// Delete начинает удаление аккаунта или продолжает ранее начатое.
+func (d *Deleter) Delete(ctx context.Context, userID, login, mode string) error {
+	if mode != ModeAnonymize && mode != ModeRemove {
+		return ErrBadMode
+	}
+	var del Deletion
+	err := d.DB.Where("user_id = ?", userID).First(&del).Error
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		del = Deletion{UserID: userID, Login: login, Mode: mode, Step: stepSessions, StartedAt: time.Now()}
+		if err = d.DB.Create(&del).Error; err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+	if !d.claim(userID) {
+		return ErrInProgress
+	}
+	defer d.release(userID)
+	return d.run(ctx, &del)
+}
+
+// Run продолжает прерванные удаления сразу и затем раз в Interval: заблокированный
+// пользователь не может повторить запрос сам, поэтому ждать следующего рестарта нельзя.
+func (d *Deleter) Run(ctx context.Context) {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultResumeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	d.ResumePending(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.ResumePending(ctx)
+		}
+	}
+}
+
+// ResumePending доводит до конца удаления, прерванные, например, рестартом сервера.
+func (d *Deleter) ResumePending(ctx context.Context) {
+	var pending []Deletion
+	if err := d.DB.Where("step <> ?", stepDone).Find(&pending).Error; err != nil {
+		d.Logger.Errorf("Не удалось получить незавершенные удаления аккаунтов: %v", err)
+		return
+	}
+	for i := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		if !d.claim(pending[i].UserID) {
+			continue
+		}
+		d.Logger.Infof("Продолжаем удаление аккаунта %s с шага %s", pending[i].Login, pending[i].Step)
+		if err := d.run(ctx, &pending[i]); err != nil {
+			d.Logger.Errorf("Удаление аккаунта %s снова прервано: %v", pending[i].Login, err)
+		}
+		d.release(pending[i].UserID)
+	}
+}
+
+// claim не дает запросу пользователя и фоновому повтору выполнять одно удаление одновременно.
+func (d *Deleter) claim(userID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running[userID] {
+		return false
+	}
+	if d.running == nil {
+		d.running = map[string]bool{}
+	}
+	d.running[userID] = true
+	return true
+}
+
+func (d *Deleter) release(userID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.running, userID)
+}
+
+func (d *Deleter) run(ctx context.Context, del *Deletion) error {
+	for idx, step := range steps {
+		if stepIndex(del.Step) > idx || step == stepDone {
+			continue
+		}
+		if err := d.runStep(ctx, del, step); err != nil {
+			return fmt.Errorf("account deletion step %s: %w", step, err)
+		}
+		next := steps[idx+1]
+		update := map[string]interface{}{"step": next}
+		if next == stepDone {
+			now := time.Now()
+			del.FinishedAt = &now
+			update["finished_at"] = now
+		}
+		if err := d.DB.Model(del).Updates(update).Error; err != nil {
+			return err
+		}
+		del.Step = next
+	}
+	d.Logger.Infof("Аккаунт %s удален (%s)", del.Login, del.Mode)
+	return nil
+}
+
+func (d *Deleter) runStep(ctx context.Context, del *Deletion, step string) error {
+	switch step {
+	case stepSessions:
+		// сначала блокируем вход, иначе между отзывом сессий и удалением пользователя
+		// можно залогиниться заново
+		err := d.UserRepo.SetSuspended(ctx, del.Login, true)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return d.Sessions.DestroyUser(ctx, del.UserID)
+	case stepVotes:
+		// DeleteVote пересчитывает Score и UpvoteCount поста. Берем и скрытые модератором
+		// посты: голоса на них тоже принадлежат пользователю
+		for _, post := range d.ItemsRepo.AllPosts(ctx) {
+			if _, ok := post.Votes[del.UserID]; ok {
+				d.ItemsRepo.DeleteVote(ctx, post.ID, del.UserID)
+			}
+		}
+		// DeleteVote не возвращает ошибку, поэтому шаг засчитываем, только когда голосов не осталось
+		if left := d.countVotes(ctx, del.UserID); left > 0 {
+			return fmt.Errorf("%d votes were not removed", left)
+		}
+		return nil
+	case stepContent:
+		if del.Mode == ModeRemove {
+			return d.ItemsRepo.DeleteByAuthor(ctx, del.UserID)
+		}
+		return d.ItemsRepo.ReplaceAuthor(ctx, del.UserID, posts.DeletedAuthor)
+	case stepUser:
+		return d.UserRepo.Delete(ctx, del.Login)
+	}
+	return nil
+}
+
+func (d *Deleter) countVotes(ctx context.Context, userID string) int {
+	n := 0
+	for _, post := range d.ItemsRepo.AllPosts(ctx) {
+		if _, ok := post.Votes[userID]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+func stepIndex(step string) int {
+	for i, s := range steps {
+		if s == step {
+			return i
+		}
+	}
+	return 0
+}
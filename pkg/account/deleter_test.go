@@ -0,0 +1,87 @@
+package account_test
+
+import (
+	"cmd/redditclone/pkg/account"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/storage"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newDeleter(t *testing.T) (*account.Deleter, user.User) {
+	t.Helper()
+	db, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	users := user.NewUserMemoryRepo(db)
+	u, err := users.SignUp(context.Background(), "alice", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &account.Deleter{
+		DB:        db,
+		UserRepo:  users,
+		Sessions:  session.NewSessionsManager(db),
+		ItemsRepo: posts.NewSQLRepo(db),
+		Logger:    zap.NewNop().Sugar(),
+		Interval:  10 * time.Millisecond,
+	}, u
+}
+
+// Прерванное удаление заблокированного пользователя доводит до конца фоновый повтор:
+// сам пользователь войти и повторить запрос уже не может.
+func TestRunResumesInterruptedDeletion(t *testing.T) {
+	d, u := newDeleter(t)
+	ctx := context.Background()
+	userID := strconv.Itoa(u.ID)
+	if err := d.UserRepo.SetSuspended(ctx, u.Login, true); err != nil {
+		t.Fatal(err)
+	}
+	err := d.DB.Create(&account.Deletion{UserID: userID, Login: u.Login, Mode: account.ModeRemove, Step: "votes", StartedAt: time.Now()}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		d.Run(runCtx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var del account.Deletion
+		if err = d.DB.Where("user_id = ?", userID).First(&del).Error; err != nil {
+			t.Fatal(err)
+		}
+		if del.FinishedAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deletion stuck at step %s", del.Step)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if _, err = d.UserRepo.GetUser(ctx, u.Login); err == nil {
+		t.Error("user still exists")
+	}
+}
+
+func TestDeleteBadMode(t *testing.T) {
+	d, u := newDeleter(t)
+	if err := d.Delete(context.Background(), strconv.Itoa(u.ID), u.Login, "wipe"); !errors.Is(err, account.ErrBadMode) {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package apierr
+
+import (
+	"cmd/redditclone/pkg/logging"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Коды - часть API: клиенты ветвятся по ним, а не по тексту сообщения.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidJSON        = "invalid_json"
+	CodeValidation         = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeTokenExpired       = "token_expired"
+	CodeTokenReused        = "token_reused"
+	CodeForbidden          = "forbidden"
+	CodeSuspended          = "account_suspended"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeArchived           = "post_archived"
+	CodeInternal           = "internal_error"
+)
+
+// requestIDHeader выставляет middleware.RequestID до вызова обработчиков
+const requestIDHeader = "X-Request-ID"
+
+// Error - ошибка, которую видит клиент. Причина (cause) только пишется в лог.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields - ошибки отдельных полей; формат errors[].param/msg понимает фронтенд
+	Fields    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	cause     error
+}
+
+type FieldError struct {
+	Location string      `json:"location"`
+	Param    string      `json:"param"`
+	Value    interface{} `json:"value,omitempty"`
+	Msg      string      `json:"msg"`
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// WithCause возвращает копию ошибки с причиной для лога.
+func (e *Error) WithCause(err error) *Error {
+	c := *e
+	c.cause = err
+	return &c
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func InvalidJSON(err error) *Error {
+	return New(http.StatusBadRequest, CodeInvalidJSON, "request body is not valid JSON: "+err.Error())
+}
+
+// Validation - 422 с ошибками по полям.
+func Validation(fields ...FieldError) *Error {
+	e := New(http.StatusUnprocessableEntity, CodeValidation, "request validation failed")
+	e.Fields = fields
+	return e
+}
+
+// Field - ошибка поля тела запроса.
+func Field(param, msg string, value interface{}) FieldError {
+	return FieldError{Location: "body", Param: param, Value: value, Msg: msg}
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Internal скрывает err от клиента: он попадает только в лог.
+func Internal(err error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, "internal server error").WithCause(err)
+}
+
+// Write - единственный способ ответить ошибкой. Ошибка не типа *Error считается внутренней.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = Internal(err)
+	}
+	resp := *apiErr
+	resp.RequestID = w.Header().Get(requestIDHeader)
+
+	logger := logging.FromContext(r.Context())
+	switch {
+	case resp.Status >= http.StatusInternalServerError:
+		logger.Errorw("Ошибка при обработке запроса", "status", resp.Status, "code", resp.Code, "error", resp.cause)
+	default:
+		logger.Infow("Запрос отклонен", "status", resp.Status, "code", resp.Code, "message", resp.Message)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.Status)
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		logger.Debugf("Не удалось отправить ошибку: %v", err)
+	}
+}
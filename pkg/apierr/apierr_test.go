@@ -0,0 +1,68 @@
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"bad request", BadRequest("bad"), http.StatusBadRequest, CodeBadRequest},
+		{"invalid json", InvalidJSON(errors.New("unexpected EOF")), http.StatusBadRequest, CodeInvalidJSON},
+		{"validation", Validation(Field("title", "required", nil)), http.StatusUnprocessableEntity, CodeValidation},
+		{"unauthorized", Unauthorized("no"), http.StatusUnauthorized, CodeUnauthorized},
+		{"forbidden", Forbidden("no"), http.StatusForbidden, CodeForbidden},
+		{"not found", NotFound("no"), http.StatusNotFound, CodeNotFound},
+		{"conflict", Conflict("no"), http.StatusConflict, CodeConflict},
+		{"internal", Internal(errors.New("db is down")), http.StatusInternalServerError, CodeInternal},
+		{"plain error", errors.New("db is down"), http.StatusInternalServerError, CodeInternal},
+		{"wrapped", errors.Join(errors.New("ctx"), NotFound("no")), http.StatusNotFound, CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.Header().Set(requestIDHeader, "req-1")
+			Write(rec, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			var body Error
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.code || body.RequestID != "req-1" {
+				t.Errorf("body = %+v", body)
+			}
+			// причина внутренней ошибки остается в логе
+			if strings.Contains(rec.Body.String(), "db is down") {
+				t.Errorf("cause leaked: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestValidationFieldsFormat(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodPost, "/", nil), Validation(Field("title", "required", "")))
+
+	var body struct {
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Errors) != 1 || body.Errors[0]["param"] != "title" || body.Errors[0]["msg"] != "required" ||
+		body.Errors[0]["location"] != "body" {
+		t.Errorf("errors = %v", body.Errors)
+	}
+}
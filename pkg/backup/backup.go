@@ -0,0 +1,225 @@
+package backup
+
+import (
+	"bufio"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/user"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// Формат: gzip поверх JSON Lines. Первая строка - заголовок, последняя - трейлер
+// с количеством записей и SHA-256 всех предыдущих строк.
+const (
+	Format  = "redditclone-backup"
+	Version = 1
+
+	kindHeader  = "header"
+	kindUser    = "user"
+	kindPost    = "post"
+	kindSession = "session"
+	kindTrailer = "trailer"
+
+	maxLineSize = 64 << 20
+)
+
+var ErrChecksum = errors.New("backup checksum mismatch: archive is corrupted or truncated")
+
+type Header struct {
+	Format   string    `json:"format"`
+	Version  int       `json:"version"`
+	Created  time.Time `json:"created"`
+	Sessions bool      `json:"sessions"`
+}
+
+type Trailer struct {
+	Counts map[string]int `json:"counts"`
+	SHA256 string         `json:"sha256"`
+}
+
+type UserRecord struct {
+	ID           int    `json:"id"`
+	Login        string `json:"login"`
+	PasswordHash string `json:"password_hash"`
+	Suspended    bool   `json:"suspended"`
+}
+
+type SessionRecord struct {
+	Token     string    `json:"token"`
+	Login     string    `json:"login"`
+	UserID    string    `json:"user_id"`
+	FamilyID  string    `json:"family_id,omitempty"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created"`
+	ExpiresAt time.Time `json:"expires"`
+}
+
+type record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type Source struct {
+	UserRepo  user.UserRepo
+	ItemsRepo posts.ItemsRepo
+	Sessions  *session.SessionsManager
+}
+
+// Backup пишет весь сайт в w. Сессии включаются только с withSessions.
+func Backup(ctx context.Context, w io.Writer, src Source, withSessions bool) (Trailer, error) {
+	gz := gzip.NewWriter(w)
+	bw := &writer{enc: gz, sum: sha256.New(), counts: map[string]int{}}
+
+	err := bw.write(kindHeader, Header{Format: Format, Version: Version, Created: time.Now().UTC(), Sessions: withSessions})
+	if err != nil {
+		return Trailer{}, err
+	}
+
+	users, err := src.UserRepo.List(ctx, "")
+	if err != nil {
+		return Trailer{}, err
+	}
+	for _, u := range users {
+		rec := UserRecord{ID: u.ID, Login: u.Login, PasswordHash: u.Password, Suspended: u.Suspended}
+		if err = bw.write(kindUser, rec); err != nil {
+			return Trailer{}, err
+		}
+	}
+
+	for _, post := range src.ItemsRepo.AllPosts(ctx) {
+		if err = bw.write(kindPost, post); err != nil {
+			return Trailer{}, err
+		}
+	}
+
+	if withSessions {
+		sessions, err := src.Sessions.All(ctx)
+		if err != nil {
+			return Trailer{}, err
+		}
+		for _, s := range sessions {
+			rec := SessionRecord{
+				Token: s.Token, Login: s.Login, UserID: s.UserID, FamilyID: s.FamilyID, IsActive: s.IsActive,
+				CreatedAt: s.CreatedAt, ExpiresAt: s.ExpiresAt,
+			}
+			if err = bw.write(kindSession, rec); err != nil {
+				return Trailer{}, err
+			}
+		}
+	}
+
+	delete(bw.counts, kindHeader)
+	trailer := Trailer{Counts: bw.counts, SHA256: hex.EncodeToString(bw.sum.Sum(nil))}
+	if err = bw.write(kindTrailer, trailer); err != nil {
+		return Trailer{}, err
+	}
+	return trailer, gz.Close()
+}
+
+type writer struct {
+	enc    io.Writer
+	sum    hash.Hash
+	counts map[string]int
+}
+
+func (w *writer) write(kind string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(record{Type: kind, Data: data})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err = w.enc.Write(line); err != nil {
+		return err
+	}
+	w.sum.Write(line)
+	w.counts[kind]++
+	return nil
+}
+
+// read разбирает архив и вызывает fn для каждой записи между заголовком и трейлером.
+// Контрольная сумма проверяется в конце, поэтому перед восстановлением архив нужно
+// сначала целиком проверить через Verify.
+func read(r io.Reader, fn func(kind string, data json.RawMessage) error) (Header, Trailer, error) {
+	var (
+		header  Header
+		trailer Trailer
+	)
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return header, trailer, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	sc := bufio.NewScanner(gz)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	sum := sha256.New()
+	counts := map[string]int{}
+	lineNo := 0
+	seenTrailer := false
+	for sc.Scan() {
+		lineNo++
+		line := sc.Bytes()
+		if seenTrailer {
+			return header, trailer, fmt.Errorf("line %d: data after trailer", lineNo)
+		}
+		var rec record
+		if err = json.Unmarshal(line, &rec); err != nil {
+			return header, trailer, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		switch {
+		case lineNo == 1:
+			if rec.Type != kindHeader {
+				return header, trailer, fmt.Errorf("line 1: expected header, got %q", rec.Type)
+			}
+			if err = json.Unmarshal(rec.Data, &header); err != nil {
+				return header, trailer, fmt.Errorf("header: %w", err)
+			}
+			if header.Format != Format || header.Version != Version {
+				return header, trailer, fmt.Errorf("unsupported backup %s v%d", header.Format, header.Version)
+			}
+		case rec.Type == kindTrailer:
+			if err = json.Unmarshal(rec.Data, &trailer); err != nil {
+				return header, trailer, fmt.Errorf("trailer: %w", err)
+			}
+			seenTrailer = true
+			continue
+		default:
+			counts[rec.Type]++
+			if err = fn(rec.Type, rec.Data); err != nil {
+				return header, trailer, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+		}
+		sum.Write(line)
+		sum.Write([]byte{'\n'})
+	}
+	if err = sc.Err(); err != nil {
+		return header, trailer, err
+	}
+	if !seenTrailer || hex.EncodeToString(sum.Sum(nil)) != trailer.SHA256 {
+		return header, trailer, ErrChecksum
+	}
+	for kind, n := range trailer.Counts {
+		if counts[kind] != n {
+			return header, trailer, fmt.Errorf("%w: %d %s records, trailer says %d", ErrChecksum, counts[kind], kind, n)
+		}
+	}
+	for kind, n := range counts {
+		if _, ok := trailer.Counts[kind]; !ok {
+			return header, trailer, fmt.Errorf("%w: %d unexpected %s records", ErrChecksum, n, kind)
+		}
+	}
+	return header, trailer, nil
+}
@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type Manifest struct {
+	Header  Header
+	Trailer Trailer
+}
+
+type Target struct {
+	UserRepo  user.UserRepo
+	ItemsRepo posts.ItemsRepo
+	// Sessions может быть nil - тогда сессии из архива пропускаются
+	Sessions *session.SessionsManager
+}
+
+// Verify проверяет архив целиком: формат, контрольную сумму и ссылочную целостность -
+// каждый автор поста, комментария, голоса и сессии должен быть среди пользователей архива.
+func Verify(r io.Reader) (Manifest, error) {
+	users := map[string]string{} // id -> login
+	var refs []reference
+
+	header, trailer, err := read(r, func(kind string, data json.RawMessage) error {
+		switch kind {
+		case kindUser:
+			var u UserRecord
+			if err := json.Unmarshal(data, &u); err != nil {
+				return err
+			}
+			users[strconv.Itoa(u.ID)] = u.Login
+		case kindPost:
+			var p posts.Post
+			if err := json.Unmarshal(data, &p); err != nil {
+				return err
+			}
+			if p.ID == "" {
+				return fmt.Errorf("post without id")
+			}
+			refs = append(refs, reference{what: "post " + p.ID, author: p.Author})
+			for id, c := range p.Comments {
+				refs = append(refs, reference{what: "comment " + id + " on post " + p.ID, author: c.Author})
+			}
+			for userID := range p.Votes {
+				refs = append(refs, reference{what: "vote on post " + p.ID, author: posts.Author{ID: userID}})
+			}
+		case kindSession:
+			var s SessionRecord
+			if err := json.Unmarshal(data, &s); err != nil {
+				return err
+			}
+			refs = append(refs, reference{what: "session", author: posts.Author{ID: s.UserID, Username: s.Login}})
+		default:
+			return fmt.Errorf("unknown record type %q", kind)
+		}
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	for _, ref := range refs {
+		if ref.author == posts.DeletedAuthor {
+			continue
+		}
+		login, ok := users[ref.author.ID]
+		if !ok {
+			return Manifest{}, fmt.Errorf("%s references missing user id %q", ref.what, ref.author.ID)
+		}
+		if ref.author.Username != "" && ref.author.Username != login {
+			return Manifest{}, fmt.Errorf("%s: author %q does not match user %s (%s)", ref.what, ref.author.Username, ref.author.ID, login)
+		}
+	}
+	return Manifest{Header: header, Trailer: trailer}, nil
+}
+
+type reference struct {
+	what   string
+	author posts.Author
+}
+
+// Restore записывает содержимое архива в target. Архив должен быть предварительно
+// проверен через Verify, иначе при повреждении в конце файла данные запишутся частично.
+func Restore(ctx context.Context, r io.Reader, target Target) (map[string]int, error) {
+	restored := map[string]int{}
+	_, _, err := read(r, func(kind string, data json.RawMessage) error {
+		switch kind {
+		case kindUser:
+			var u UserRecord
+			if err := json.Unmarshal(data, &u); err != nil {
+				return err
+			}
+			err := target.UserRepo.Import(ctx, user.User{ID: u.ID, Login: u.Login, Password: u.PasswordHash, Suspended: u.Suspended})
+			if err != nil {
+				return fmt.Errorf("user %s: %w", u.Login, err)
+			}
+		case kindPost:
+			var p posts.Post
+			if err := json.Unmarshal(data, &p); err != nil {
+				return err
+			}
+			if err := target.ItemsRepo.ImportPost(ctx, &p); err != nil {
+				return fmt.Errorf("post %s: %w", p.ID, err)
+			}
+		case kindSession:
+			if target.Sessions == nil {
+				return nil
+			}
+			var s SessionRecord
+			if err := json.Unmarshal(data, &s); err != nil {
+				return err
+			}
+			err := target.Sessions.Import(ctx, session.Session{
+				Token: s.Token, Login: s.Login, UserID: s.UserID, FamilyID: s.FamilyID, IsActive: s.IsActive,
+				CreatedAt: s.CreatedAt, ExpiresAt: s.ExpiresAt,
+			})
+			if err != nil {
+				return fmt.Errorf("session of %s: %w", s.Login, err)
+			}
+		}
+		restored[kind]++
+		return nil
+	})
+	return restored, err
+}
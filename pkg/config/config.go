@@ -0,0 +1,392 @@
+package config
+
+import (
+	"bytes"
+	"cmd/redditclone/pkg/posts"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// минимальная длина ключа подписи HS256
+const (
+	minSecretLen = 32
+	// больший допуск фактически продлевает жизнь каждого токена
+	maxJWTLeeway = 5 * time.Minute
+)
+
+type Config struct {
+	Listen    string `yaml:"listen"`
+	StaticDir string `yaml:"static_dir"`
+	IndexFile string `yaml:"index_file"`
+	// JWTSecret - ключ HS256 с kid "secret"; необязателен, если ключи лежат в JWTKeysDir
+	JWTSecret string `yaml:"jwt_secret"`
+	// JWTKeysDir - каталог ключей <kid>.secret (HS256) и <kid>.pem (RS256, EdDSA)
+	JWTKeysDir string `yaml:"jwt_keys_dir"`
+	// JWTActiveKey - kid ключа, которым подписываются новые токены
+	JWTActiveKey string `yaml:"jwt_active_key"`
+	// JWTRetiredKeys - kid через запятую; подписанные ими токены больше не принимаются
+	JWTRetiredKeys string `yaml:"jwt_retired_keys"`
+	// JWTLeeway - допуск на расхождение часов при проверке exp/iat/nbf
+	JWTLeeway time.Duration `yaml:"jwt_leeway"`
+	// AccessTokenTTL - срок жизни JWT; дальше клиент обменивает refresh-токен на новый
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	ArchiveAge      string        `yaml:"archive_age"`
+	ExportDir       string        `yaml:"export_dir"`
+	Timeouts        Timeouts      `yaml:"timeouts"`
+	Storage         Storage       `yaml:"storage"`
+	Tracing         Tracing       `yaml:"tracing"`
+}
+
+type Timeouts struct {
+	Read       time.Duration `yaml:"read"`
+	ReadHeader time.Duration `yaml:"read_header"`
+	// Write не действует на SSE и WebSocket - они снимают дедлайн сами
+	Write time.Duration `yaml:"write"`
+	Idle  time.Duration `yaml:"idle"`
+	// Shutdown - сколько ждать завершения запросов и фоновых задач после SIGTERM
+	Shutdown time.Duration `yaml:"shutdown"`
+	// HealthCheck - таймаут пинга каждой базы в /readyz
+	HealthCheck time.Duration `yaml:"health_check"`
+}
+
+type Storage struct {
+	// Kind - mysql или sqlite
+	Kind string `yaml:"kind"`
+	// Posts - где хранить посты при Kind=mysql: mongo или mysql
+	Posts         string `yaml:"posts"`
+	Migrate       bool   `yaml:"migrate"`
+	MySQLDSN      string `yaml:"mysql_dsn"`
+	MongoURI      string `yaml:"mongo_uri"`
+	MongoDatabase string `yaml:"mongo_database"`
+	SQLitePath    string `yaml:"sqlite_path"`
+	// общий пул MySQL для пользователей, сессий и постов
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type Tracing struct {
+	// Exporter - none, stdout или file
+	Exporter string `yaml:"exporter"`
+	File     string `yaml:"file"`
+	// SampleRatio - доля трасс, начатых у нас; входящий traceparent решает сам
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+func Default() *Config {
+	return &Config{
+		Listen:     ":8080",
+		StaticDir:  "static",
+		IndexFile:  "static/html/index.html",
+		ArchiveAge: "4320h",
+		JWTLeeway:  30 * time.Second,
+
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 30 * 24 * time.Hour,
+		Timeouts: Timeouts{
+			Read:       15 * time.Second,
+			ReadHeader: 5 * time.Second,
+			Write:      30 * time.Second,
+			Idle:       2 * time.Minute,
+			Shutdown:   20 * time.Second,
+
+			HealthCheck: 2 * time.Second,
+		},
+		Storage: Storage{
+			Kind:          "mysql",
+			Posts:         "mongo",
+			MySQLDSN:      "root:@tcp(localhost:3306)/reddit_clone?parseTime=true",
+			MongoURI:      "mongodb://localhost",
+			MongoDatabase: "reddit_clone",
+			SQLitePath:    "redditclone.db",
+
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 5 * time.Minute,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			File:        "traces.jsonl",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// option связывает поле конфига с переменной окружения и флагом.
+// Пустой flag - значение нельзя передать в командной строке (секреты видны в ps).
+type option struct {
+	key      string
+	env      string
+	flag     string
+	usage    string
+	str      func(c *Config) *string
+	boolean  func(c *Config) *bool
+	integer  func(c *Config) *int
+	duration func(c *Config) *time.Duration
+	number   func(c *Config) *float64
+}
+
+var options = []option{
+	{key: "listen", env: "REDDIT_LISTEN", flag: "listen", usage: "HTTP listen address",
+		str: func(c *Config) *string { return &c.Listen }},
+	{key: "static_dir", env: "REDDIT_STATIC_DIR", flag: "static-dir", usage: "directory served under /static/",
+		str: func(c *Config) *string { return &c.StaticDir }},
+	{key: "index_file", env: "REDDIT_INDEX_FILE", flag: "index-file", usage: "index.html template",
+		str: func(c *Config) *string { return &c.IndexFile }},
+	{key: "jwt_secret", env: "REDDIT_JWT_SECRET",
+		str: func(c *Config) *string { return &c.JWTSecret }},
+	{key: "jwt_keys_dir", env: "REDDIT_JWT_KEYS_DIR", flag: "jwt-keys-dir", usage: "directory of signing keys: <kid>.secret (HS256) and <kid>.pem (RS256, EdDSA)",
+		str: func(c *Config) *string { return &c.JWTKeysDir }},
+	{key: "jwt_active_key", env: "REDDIT_JWT_ACTIVE_KEY", flag: "jwt-active-key", usage: "kid of the key that signs new tokens",
+		str: func(c *Config) *string { return &c.JWTActiveKey }},
+	{key: "jwt_retired_keys", env: "REDDIT_JWT_RETIRED_KEYS", flag: "jwt-retired-keys", usage: "comma-separated kids whose tokens are no longer accepted",
+		str: func(c *Config) *string { return &c.JWTRetiredKeys }},
+	{key: "jwt_leeway", env: "REDDIT_JWT_LEEWAY", flag: "jwt-leeway", usage: "allowed clock skew when checking token exp/iat/nbf",
+		duration: func(c *Config) *time.Duration { return &c.JWTLeeway }},
+	{key: "access_token_ttl", env: "REDDIT_ACCESS_TOKEN_TTL", flag: "access-token-ttl", usage: "lifetime of access tokens (JWT)",
+		duration: func(c *Config) *time.Duration { return &c.AccessTokenTTL }},
+	{key: "refresh_token_ttl", env: "REDDIT_REFRESH_TOKEN_TTL", flag: "refresh-token-ttl", usage: "lifetime of refresh tokens",
+		duration: func(c *Config) *time.Duration { return &c.RefreshTokenTTL }},
+	{key: "archive_age", env: "REDDIT_ARCHIVE_AGE", flag: "archive-age",
+		usage: "archive age: default duration and per-category overrides, e.g. 4320h,news=720h",
+		str:   func(c *Config) *string { return &c.ArchiveAge }},
+	{key: "export_dir", env: "REDDIT_EXPORT_DIR", flag: "export-dir", usage: "directory for personal data exports (default: temp dir)",
+		str: func(c *Config) *string { return &c.ExportDir }},
+	{key: "storage.kind", env: "REDDIT_STORAGE", flag: "storage", usage: "storage backend: mysql (with -posts-store) or sqlite",
+		str: func(c *Config) *string { return &c.Storage.Kind }},
+	{key: "storage.posts", env: "REDDIT_POSTS_STORE", flag: "posts-store", usage: "where posts are stored with -storage mysql: mongo or mysql",
+		str: func(c *Config) *string { return &c.Storage.Posts }},
+	{key: "storage.migrate", env: "REDDIT_MIGRATE", flag: "migrate", usage: "apply pending database migrations on startup",
+		boolean: func(c *Config) *bool { return &c.Storage.Migrate }},
+	{key: "storage.mysql_dsn", env: "REDDIT_MYSQL_DSN", flag: "mysql-dsn", usage: "MySQL DSN, must include parseTime=true",
+		str: func(c *Config) *string { return &c.Storage.MySQLDSN }},
+	{key: "storage.mongo_uri", env: "REDDIT_MONGO_URI", flag: "mongo-uri", usage: "MongoDB connection URI",
+		str: func(c *Config) *string { return &c.Storage.MongoURI }},
+	{key: "storage.mongo_database", env: "REDDIT_MONGO_DATABASE", flag: "mongo-database", usage: "MongoDB database name",
+		str: func(c *Config) *string { return &c.Storage.MongoDatabase }},
+	{key: "storage.sqlite_path", env: "REDDIT_SQLITE_PATH", flag: "sqlite-path", usage: "database file for -storage sqlite, created on first start",
+		str: func(c *Config) *string { return &c.Storage.SQLitePath }},
+	{key: "storage.max_open_conns", env: "REDDIT_DB_MAX_OPEN_CONNS", flag: "db-max-open-conns", usage: "maximum open MySQL connections",
+		integer: func(c *Config) *int { return &c.Storage.MaxOpenConns }},
+	{key: "storage.max_idle_conns", env: "REDDIT_DB_MAX_IDLE_CONNS", flag: "db-max-idle-conns", usage: "maximum idle MySQL connections",
+		integer: func(c *Config) *int { return &c.Storage.MaxIdleConns }},
+	{key: "storage.conn_max_lifetime", env: "REDDIT_DB_CONN_MAX_LIFETIME", flag: "db-conn-max-lifetime", usage: "maximum lifetime of a MySQL connection",
+		duration: func(c *Config) *time.Duration { return &c.Storage.ConnMaxLifetime }},
+	{key: "timeouts.read", env: "REDDIT_READ_TIMEOUT", flag: "read-timeout", usage: "HTTP read timeout",
+		duration: func(c *Config) *time.Duration { return &c.Timeouts.Read }},
+	{key: "timeouts.read_header", env: "REDDIT_READ_HEADER_TIMEOUT", flag: "read-header-timeout", usage: "HTTP read header timeout",
+		duration: func(c *Config) *time.Duration { return &c.Timeouts.ReadHeader }},
+	{key: "timeouts.write", env: "REDDIT_WRITE_TIMEOUT", flag: "write-timeout", usage: "HTTP write timeout (not applied to event streams)",
+		duration: func(c *Config) *time.Duration { return &c.Timeouts.Write }},
+	{key: "timeouts.idle", env: "REDDIT_IDLE_TIMEOUT", flag: "idle-timeout", usage: "HTTP keep-alive idle timeout",
+		duration: func(c *Config) *time.Duration { return &c.Timeouts.Idle }},
+	{key: "timeouts.shutdown", env: "REDDIT_SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "how long to drain requests and jobs on shutdown",
+		duration: func(c *Config) *time.Duration { return &c.Timeouts.Shutdown }},
+	{key: "timeouts.health_check", env: "REDDIT_HEALTH_CHECK_TIMEOUT", flag: "health-check-timeout", usage: "timeout of each dependency ping in /readyz",
+		duration: func(c *Config) *time.Duration { return &c.Timeouts.HealthCheck }},
+	{key: "tracing.exporter", env: "REDDIT_TRACE_EXPORTER", flag: "trace-exporter", usage: "where to write spans: none, stdout or file",
+		str: func(c *Config) *string { return &c.Tracing.Exporter }},
+	{key: "tracing.file", env: "REDDIT_TRACE_FILE", flag: "trace-file", usage: "span file for -trace-exporter file, one JSON span per line",
+		str: func(c *Config) *string { return &c.Tracing.File }},
+	{key: "tracing.sample_ratio", env: "REDDIT_TRACE_SAMPLE_RATIO", flag: "trace-sample-ratio", usage: "fraction of new traces to record, 0..1",
+		number: func(c *Config) *float64 { return &c.Tracing.SampleRatio }},
+}
+
+func (o option) set(c *Config, value string) error {
+	switch {
+	case o.boolean != nil:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected true or false, got %q", o.key, value)
+		}
+		*o.boolean(c) = b
+	case o.integer != nil:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected an integer, got %q", o.key, value)
+		}
+		*o.integer(c) = n
+	case o.duration != nil:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected a duration like 30s, got %q", o.key, value)
+		}
+		*o.duration(c) = d
+	case o.number != nil:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: expected a number, got %q", o.key, value)
+		}
+		*o.number(c) = f
+	default:
+		*o.str(c) = value
+	}
+	return nil
+}
+
+// flagValue откладывает значение флага: флаги применяются последними, поверх файла и окружения.
+type flagValue struct {
+	opt     option
+	pending map[string]string
+}
+
+func (f *flagValue) String() string { return "" }
+
+func (f *flagValue) Set(value string) error {
+	f.pending[f.opt.key] = value
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.opt.boolean != nil }
+
+// Load собирает конфиг: значения по умолчанию, затем YAML-файл (-config или REDDIT_CONFIG),
+// затем переменные окружения, затем флаги. Свои флаги вызывающий регистрирует в fs заранее,
+// позиционные аргументы после разбора доступны через fs.Args().
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	pending := map[string]string{}
+	for _, opt := range options {
+		if opt.flag != "" {
+			fs.Var(&flagValue{opt: opt, pending: pending}, opt.flag, opt.usage)
+		}
+	}
+	path := fs.String("config", os.Getenv("REDDIT_CONFIG"), "YAML config file (env REDDIT_CONFIG)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	for _, opt := range options {
+		if value, ok := os.LookupEnv(opt.env); ok {
+			if err := opt.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("config: %s: %w", opt.env, err)
+			}
+		}
+	}
+	for _, opt := range options {
+		if value, ok := pending[opt.key]; ok {
+			if err := opt.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("config: -%s: %w", opt.flag, err)
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	// опечатка в имени ключа не должна молча оставлять значение по умолчанию
+	dec.KnownFields(true)
+	if err = dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate проверяет настройки, общие для сервера и утилит.
+func (c *Config) Validate() error {
+	var errs []error
+	switch c.Storage.Kind {
+	case "mysql":
+		if c.Storage.MySQLDSN == "" {
+			errs = append(errs, errors.New("storage.mysql_dsn is required for storage.kind mysql (env REDDIT_MYSQL_DSN)"))
+		} else if dsn, err := mysql.ParseDSN(c.Storage.MySQLDSN); err != nil {
+			errs = append(errs, fmt.Errorf("storage.mysql_dsn: %w", err))
+		} else if !dsn.ParseTime {
+			errs = append(errs, errors.New("storage.mysql_dsn must include parseTime=true"))
+		}
+		switch c.Storage.Posts {
+		case "mongo":
+			if c.Storage.MongoURI == "" || c.Storage.MongoDatabase == "" {
+				errs = append(errs, errors.New("storage.mongo_uri and storage.mongo_database are required for storage.posts mongo"))
+			}
+		case "mysql":
+		default:
+			errs = append(errs, fmt.Errorf("storage.posts must be mongo or mysql, got %q", c.Storage.Posts))
+		}
+	case "sqlite":
+		if c.Storage.SQLitePath == "" {
+			errs = append(errs, errors.New("storage.sqlite_path is required for storage.kind sqlite (env REDDIT_SQLITE_PATH)"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage.kind must be mysql or sqlite, got %q", c.Storage.Kind))
+	}
+	if c.Storage.MaxOpenConns < 0 || c.Storage.MaxIdleConns < 0 || c.Storage.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("storage pool limits must not be negative"))
+	}
+	if _, err := posts.ParseArchivePolicy(c.ArchiveAge); err != nil {
+		errs = append(errs, fmt.Errorf("archive_age: %w", err))
+	}
+	return wrap(errs)
+}
+
+// ValidateServer дополнительно проверяет то, что нужно только HTTP-серверу.
+func (c *Config) ValidateServer() error {
+	var errs []error
+	if c.Listen == "" {
+		errs = append(errs, errors.New("listen is required (env REDDIT_LISTEN)"))
+	}
+	if c.Timeouts.Read < 0 || c.Timeouts.ReadHeader < 0 || c.Timeouts.Write < 0 || c.Timeouts.Idle < 0 || c.Timeouts.HealthCheck < 0 {
+		errs = append(errs, errors.New("timeouts must not be negative (0 disables a timeout)"))
+	}
+	if c.Timeouts.Shutdown <= 0 {
+		errs = append(errs, errors.New("timeouts.shutdown must be positive"))
+	}
+	if c.JWTKeysDir == "" && len(c.JWTSecret) < minSecretLen {
+		errs = append(errs, fmt.Errorf("jwt_secret must be at least %d bytes (env REDDIT_JWT_SECRET) unless jwt_keys_dir is set", minSecretLen))
+	}
+	if c.JWTKeysDir != "" && c.JWTSecret != "" && len(c.JWTSecret) < minSecretLen {
+		errs = append(errs, fmt.Errorf("jwt_secret must be at least %d bytes (env REDDIT_JWT_SECRET)", minSecretLen))
+	}
+	if c.JWTLeeway < 0 || c.JWTLeeway > maxJWTLeeway {
+		errs = append(errs, fmt.Errorf("jwt_leeway must be between 0 and %v", maxJWTLeeway))
+	}
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= c.AccessTokenTTL {
+		errs = append(errs, errors.New("access_token_ttl must be positive and shorter than refresh_token_ttl"))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			errs = append(errs, errors.New("tracing.file is required for tracing.exporter file (env REDDIT_TRACE_FILE)"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be none, stdout or file, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sample_ratio must be between 0 and 1"))
+	}
+	if _, err := os.Stat(c.IndexFile); err != nil {
+		errs = append(errs, fmt.Errorf("index_file: %w", err))
+	}
+	if info, err := os.Stat(c.StaticDir); err != nil || !info.IsDir() {
+		errs = append(errs, fmt.Errorf("static_dir %q is not a directory", c.StaticDir))
+	}
+	return wrap(errs)
+}
+
+func wrap(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+}
@@ -0,0 +1,198 @@
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBufferSize = 64
+	defaultReplaySize = 100
+	defaultIdleTTL    = 2 * time.Minute
+)
+
+type Event struct {
+	ID    uint64          `json:"id"`
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Hub - простая in-process шина событий. Каждый топик хранит ограниченный буфер
+// последних событий, чтобы переподключившийся клиент мог догнать пропущенное.
+// Publish никогда не блокируется: если подписчик не успевает читать, его канал
+// закрывается и подписка удаляется.
+//
+// Топик живет, пока на него кто-то подписан, и еще idleTTL после ухода последнего
+// подписчика. События в топик без подписчиков отбрасываются, поэтому Last-Event-ID
+// догоняет пропущенное только при переподключении в пределах idleTTL.
+type Hub struct {
+	mu         sync.Mutex
+	lastID     uint64
+	topics     map[string]*topic
+	bufferSize int
+	replaySize int
+	idleTTL    time.Duration
+	lastSweep  time.Time
+	now        func() time.Time
+	closed     bool
+}
+
+type topic struct {
+	subs   map[*Subscription]struct{}
+	replay []Event
+	// когда ушел последний подписчик
+	idleSince time.Time
+}
+
+type Subscription struct {
+	C     <-chan Event
+	ch    chan Event
+	hub   *Hub
+	topic string
+	once  sync.Once
+}
+
+func NewHub(bufferSize, replaySize int, idleTTL time.Duration) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	if replaySize <= 0 {
+		replaySize = defaultReplaySize
+	}
+	if idleTTL <= 0 {
+		idleTTL = defaultIdleTTL
+	}
+	return &Hub{
+		topics:     make(map[string]*topic),
+		bufferSize: bufferSize,
+		replaySize: replaySize,
+		idleTTL:    idleTTL,
+		now:        time.Now,
+	}
+}
+
+// expired - топик без подписчиков дольше idleTTL.
+func (h *Hub) expired(t *topic, now time.Time) bool {
+	return len(t.subs) == 0 && now.Sub(t.idleSince) >= h.idleTTL
+}
+
+// sweep удаляет простаивающие топики. Полный проход не чаще раза в idleTTL.
+func (h *Hub) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < h.idleTTL {
+		return
+	}
+	h.lastSweep = now
+	for name, t := range h.topics {
+		if h.expired(t, now) {
+			delete(h.topics, name)
+		}
+	}
+}
+
+func (h *Hub) unsubscribe(t *topic, sub *Subscription) {
+	if _, ok := t.subs[sub]; !ok {
+		return
+	}
+	delete(t.subs, sub)
+	if len(t.subs) == 0 {
+		t.idleSince = h.now()
+	}
+}
+
+// Subscribe подписывает на топик и возвращает события из буфера с ID больше lastEventID.
+// Подписка и выборка буфера происходят под одной блокировкой, поэтому события не теряются
+// и не дублируются между replay и каналом.
+func (h *Hub) Subscribe(name string, lastEventID uint64) (*Subscription, []Event) {
+	ch := make(chan Event, h.bufferSize)
+	sub := &Subscription{C: ch, ch: ch, hub: h, topic: name}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		sub.once.Do(func() { close(ch) })
+		return sub, nil
+	}
+	now := h.now()
+	h.sweep(now)
+	t, ok := h.topics[name]
+	if !ok || h.expired(t, now) {
+		t = &topic{subs: make(map[*Subscription]struct{})}
+		h.topics[name] = t
+	}
+	t.subs[sub] = struct{}{}
+
+	var missed []Event
+	if lastEventID > 0 {
+		for _, ev := range t.replay {
+			if ev.ID > lastEventID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	return sub, missed
+}
+
+// Publish рассылает событие подписчикам топика. Если топика нет или он простаивает
+// дольше idleTTL, событие отбрасывается: догонять его некому.
+func (h *Hub) Publish(name, eventType string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	h.sweep(now)
+	t, ok := h.topics[name]
+	if !ok {
+		return nil
+	}
+	if h.expired(t, now) {
+		delete(h.topics, name)
+		return nil
+	}
+	h.lastID++
+	ev := Event{ID: h.lastID, Topic: name, Type: eventType, Data: raw}
+
+	t.replay = append(t.replay, ev)
+	if len(t.replay) > h.replaySize {
+		t.replay = t.replay[len(t.replay)-h.replaySize:]
+	}
+
+	for sub := range t.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			// медленный клиент: отключаем, он переподключится с Last-Event-ID
+			h.unsubscribe(t, sub)
+			sub.once.Do(func() { close(sub.ch) })
+		}
+	}
+	return nil
+}
+
+// Close закрывает все подписки - при остановке сервера это завершает SSE-потоки
+// и WebSocket-подключения. Новые подписки после Close сразу закрыты.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, t := range h.topics {
+		for sub := range t.subs {
+			delete(t.subs, sub)
+			sub.once.Do(func() { close(sub.ch) })
+		}
+	}
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if t, ok := s.hub.topics[s.topic]; ok {
+		s.hub.unsubscribe(t, s)
+	}
+	s.once.Do(func() { close(s.ch) })
+}
@@ -0,0 +1,191 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time      { return c.t }
+func (c *fakeClock) add(d time.Duration) { c.t = c.t.Add(d) }
+func newTestHub(buffer, replay int) (*Hub, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := NewHub(buffer, replay, time.Minute)
+	h.now = clock.now
+	return h, clock
+}
+
+func ids(evs []Event) []uint64 {
+	res := make([]uint64, 0, len(evs))
+	for _, ev := range evs {
+		res = append(res, ev.ID)
+	}
+	return res
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPublishWithoutSubscribersIsDropped(t *testing.T) {
+	h, _ := newTestHub(4, 10)
+	for i := 0; i < 1000; i++ {
+		if err := h.Publish(PostTopic("p"), VoteChanged, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(h.topics) != 0 {
+		t.Fatalf("topics = %d, want 0", len(h.topics))
+	}
+	sub, missed := h.Subscribe(PostTopic("p"), 1)
+	defer sub.Close()
+	if len(missed) != 0 {
+		t.Fatalf("missed = %v, want none", ids(missed))
+	}
+}
+
+func TestReplayAfterReconnect(t *testing.T) {
+	h, clock := newTestHub(4, 10)
+	topic := PostTopic("p")
+	sub, _ := h.Subscribe(topic, 0)
+	for i := 0; i < 3; i++ {
+		h.Publish(topic, VoteChanged, i)
+	}
+	var got []Event
+	for i := 0; i < 3; i++ {
+		got = append(got, <-sub.C)
+	}
+	sub.Close()
+
+	// клиент отключился, событие пришло, пока он переподключается
+	clock.add(30 * time.Second)
+	h.Publish(topic, VoteChanged, 3)
+
+	sub, missed := h.Subscribe(topic, got[1].ID)
+	defer sub.Close()
+	if want := []uint64{got[2].ID, got[2].ID + 1}; !equalIDs(ids(missed), want) {
+		t.Fatalf("missed = %v, want %v", ids(missed), want)
+	}
+}
+
+func TestReplayBufferIsBounded(t *testing.T) {
+	h, _ := newTestHub(16, 3)
+	topic := CategoryTopic("music")
+	sub, _ := h.Subscribe(topic, 0)
+	for i := 0; i < 10; i++ {
+		h.Publish(topic, PostCreated, i)
+	}
+	sub.Close()
+
+	sub, missed := h.Subscribe(topic, 1)
+	defer sub.Close()
+	if want := []uint64{8, 9, 10}; !equalIDs(ids(missed), want) {
+		t.Fatalf("missed = %v, want %v", ids(missed), want)
+	}
+}
+
+func TestIdleTopicIsEvicted(t *testing.T) {
+	h, clock := newTestHub(4, 10)
+	sub, _ := h.Subscribe(PostTopic("a"), 0)
+	h.Publish(PostTopic("a"), VoteChanged, 1)
+	sub.Close()
+	other, _ := h.Subscribe(PostTopic("b"), 0)
+	defer other.Close()
+
+	clock.add(2 * time.Minute)
+	h.Publish(PostTopic("a"), VoteChanged, 2)
+	if _, ok := h.topics[PostTopic("a")]; ok {
+		t.Fatal("idle topic was not evicted")
+	}
+	if _, ok := h.topics[PostTopic("b")]; !ok {
+		t.Fatal("topic with a subscriber was evicted")
+	}
+
+	sub, missed := h.Subscribe(PostTopic("a"), 0)
+	defer sub.Close()
+	sub2, missed2 := h.Subscribe(PostTopic("a"), 1)
+	defer sub2.Close()
+	if len(missed)+len(missed2) != 0 {
+		t.Fatalf("evicted topic replayed %v", ids(missed2))
+	}
+}
+
+func TestSweepRemovesIdleTopics(t *testing.T) {
+	h, clock := newTestHub(4, 10)
+	for _, name := range []string{"a", "b", "c"} {
+		sub, _ := h.Subscribe(PostTopic(name), 0)
+		sub.Close()
+	}
+	clock.add(2 * time.Minute)
+	h.Publish(UserTopic("nobody"), PostCreated, nil)
+	if len(h.topics) != 0 {
+		t.Fatalf("topics = %d, want 0", len(h.topics))
+	}
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	h, _ := newTestHub(2, 10)
+	topic := PostTopic("p")
+	slow, _ := h.Subscribe(topic, 0)
+	fast, _ := h.Subscribe(topic, 0)
+	defer fast.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			h.Publish(topic, VoteChanged, i)
+			<-fast.C
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	var received []Event
+	for ev := range slow.C {
+		received = append(received, ev)
+	}
+	if want := []uint64{1, 2}; !equalIDs(ids(received), want) {
+		t.Fatalf("slow subscriber got %v, want %v before disconnect", ids(received), want)
+	}
+	if _, ok := h.topics[topic].subs[slow]; ok {
+		t.Fatal("slow subscriber is still registered")
+	}
+	// повторный Close после отключения hub-ом не паникует
+	slow.Close()
+
+	// переподключение с последним полученным ID догоняет пропущенное
+	again, missed := h.Subscribe(topic, received[len(received)-1].ID)
+	defer again.Close()
+	if want := []uint64{3, 4, 5}; !equalIDs(ids(missed), want) {
+		t.Fatalf("missed = %v, want %v", ids(missed), want)
+	}
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	h, _ := newTestHub(4, 10)
+	sub, _ := h.Subscribe(PostTopic("p"), 0)
+	h.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("subscription is still open after Close")
+	}
+	late, _ := h.Subscribe(PostTopic("p"), 0)
+	if _, ok := <-late.C; ok {
+		t.Fatal("subscription after Close is open")
+	}
+	if err := h.Publish(PostTopic("p"), VoteChanged, 1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,131 @@
+package events
+
+import (
+	"cmd/redditclone/pkg/logging"
+	"cmd/redditclone/pkg/posts"
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	PostCreated    = "post_created"
+	CommentAdded   = "comment_added"
+	CommentDeleted = "comment_deleted"
+	VoteChanged    = "vote_changed"
+)
+
+const (
+	postPrefix     = "post:"
+	categoryPrefix = "category:"
+	userPrefix     = "user:"
+)
+
+func PostTopic(postID string) string {
+	return postPrefix + postID
+}
+
+func CategoryTopic(category string) string {
+	return categoryPrefix + category
+}
+
+func UserTopic(login string) string {
+	return userPrefix + login
+}
+
+// ValidTopic проверяет, что на канал можно подписаться извне.
+func ValidTopic(name string) bool {
+	switch {
+	case strings.HasPrefix(name, postPrefix):
+		return len(name) > len(postPrefix)
+	case strings.HasPrefix(name, userPrefix):
+		return len(name) > len(userPrefix)
+	case strings.HasPrefix(name, categoryPrefix):
+		return posts.IsCategory(strings.TrimPrefix(name, categoryPrefix))
+	}
+	return false
+}
+
+// PublishingRepo оборачивает posts.ItemsRepo и публикует в Hub изменения постов.
+// Каждое событие попадает в канал поста, его категории и автора.
+type PublishingRepo struct {
+	posts.ItemsRepo
+	Hub     *Hub
+	Archive posts.ArchivePolicy
+}
+
+func NewPublishingRepo(repo posts.ItemsRepo, hub *Hub, archive posts.ArchivePolicy) *PublishingRepo {
+	return &PublishingRepo{ItemsRepo: repo, Hub: hub, Archive: archive}
+}
+
+func (p *PublishingRepo) publish(ctx context.Context, eventType string, post *posts.PostToFront, extraTopics ...string) {
+	if post == nil || post.ID == "" {
+		return
+	}
+	topics := append([]string{
+		PostTopic(post.ID),
+		CategoryTopic(post.Category),
+		UserTopic(post.Author.Username),
+	}, extraTopics...)
+	for _, t := range topics {
+		if err := p.Hub.Publish(t, eventType, post); err != nil {
+			logging.FromContext(ctx).Errorf("Не удалось опубликовать событие %s: %v", eventType, err)
+		}
+	}
+}
+
+func (p *PublishingRepo) publishPost(ctx context.Context, eventType string, post *posts.Post, extraTopics ...string) {
+	if post == nil {
+		return
+	}
+	p.publish(ctx, eventType, p.Archive.ToFront(post, time.Now()), extraTopics...)
+}
+
+func (p *PublishingRepo) AddPost(ctx context.Context, post *posts.PostToFront) {
+	p.ItemsRepo.AddPost(ctx, post)
+	p.publish(ctx, PostCreated, post)
+}
+
+func (p *PublishingRepo) PublishDraft(ctx context.Context, postID string, now time.Time) (*posts.Post, bool) {
+	post, ok := p.ItemsRepo.PublishDraft(ctx, postID, now)
+	if ok {
+		p.publishPost(ctx, PostCreated, post)
+	}
+	return post, ok
+}
+
+func (p *PublishingRepo) PublishDue(ctx context.Context, now time.Time) []*posts.Post {
+	published := p.ItemsRepo.PublishDue(ctx, now)
+	for _, post := range published {
+		p.publishPost(ctx, PostCreated, post)
+	}
+	return published
+}
+
+func (p *PublishingRepo) AddComment(ctx context.Context, postID string, comment posts.Comment) *posts.Post {
+	post := p.ItemsRepo.AddComment(ctx, postID, comment)
+	var extra []string
+	if post != nil && comment.Author.Username != post.Author.Username {
+		extra = append(extra, UserTopic(comment.Author.Username))
+	}
+	p.publishPost(ctx, CommentAdded, post, extra...)
+	return post
+}
+
+func (p *PublishingRepo) DeleteComment(ctx context.Context, postID string, commentID string) *posts.Post {
+	post := p.ItemsRepo.DeleteComment(ctx, postID, commentID)
+	p.publishPost(ctx, CommentDeleted, post)
+	return post
+}
+
+func (p *PublishingRepo) AddVote(ctx context.Context, postID string, userID string, vote posts.Vote) *posts.Post {
+	post := p.ItemsRepo.AddVote(ctx, postID, userID, vote)
+	p.publishPost(ctx, VoteChanged, post)
+	return post
+}
+
+func (p *PublishingRepo) DeleteVote(ctx context.Context, postID string, userID string) *posts.Post {
+	post := p.ItemsRepo.DeleteVote(ctx, postID, userID)
+	p.publishPost(ctx, VoteChanged, post)
+	return post
+}
@@ -0,0 +1,128 @@
+package export
+
+import (
+	"archive/zip"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+)
+
+type accountRecord struct {
+	ID    string `json:"id"`
+	Login string `json:"login"`
+}
+
+type sessionRecord struct {
+	TokenSuffix string    `json:"token_suffix"`
+	IsActive    bool      `json:"is_active"`
+	CreatedAt   time.Time `json:"created"`
+	ExpiresAt   time.Time `json:"expires"`
+}
+
+type commentRecord struct {
+	PostID    string    `json:"post_id"`
+	PostTitle string    `json:"post_title"`
+	ID        string    `json:"id"`
+	Body      string    `json:"body"`
+	Created   time.Time `json:"created"`
+}
+
+type voteRecord struct {
+	PostID    string `json:"post_id"`
+	PostTitle string `json:"post_title"`
+	Vote      int    `json:"vote"`
+}
+
+func (m *Manager) build(ctx context.Context, path, userID, login string) (int64, error) {
+	account, err := m.UserRepo.GetUser(ctx, login)
+	if err != nil {
+		return 0, err
+	}
+	sessions, err := m.Sessions.UserSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	authored := make([]*posts.PostToFront, 0)
+	comments := make([]commentRecord, 0)
+	votes := make([]voteRecord, 0)
+	// AllPosts отдает и черновики, и скрытые модерацией посты: выгрузка должна быть полной
+	for _, post := range m.ItemsRepo.AllPosts(ctx) {
+		if post.Author.ID == userID {
+			authored = append(authored, posts.ConstructPostToFront(post))
+		}
+		for _, c := range post.Comments {
+			if c.Author.ID == userID {
+				comments = append(comments, commentRecord{
+					PostID: post.ID, PostTitle: post.Title, ID: c.ID, Body: c.Body, Created: c.Created,
+				})
+			}
+		}
+		if v, ok := post.Votes[userID]; ok && v != nil {
+			votes = append(votes, voteRecord{PostID: post.ID, PostTitle: post.Title, Vote: v.Vote})
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"account.json", accountRecord{ID: strconv.Itoa(account.ID), Login: account.Login}},
+		{"sessions.json", sessionRecords(sessions)},
+		{"posts.json", authored},
+		{"comments.json", comments},
+		{"votes.json", votes},
+	}
+	for _, file := range files {
+		// gorm не прерывает запросы по контексту, поэтому проверяем отмену между шагами
+		if err = ctx.Err(); err != nil {
+			return 0, err
+		}
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return 0, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(file.data); err != nil {
+			return 0, err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// сами токены в выгрузку не попадают - это действующие учетные данные
+func sessionRecords(sessions []session.Session) []sessionRecord {
+	records := make([]sessionRecord, 0, len(sessions))
+	for _, s := range sessions {
+		suffix := s.Token
+		if len(suffix) > 6 {
+			suffix = suffix[len(suffix)-6:]
+		}
+		records = append(records, sessionRecord{
+			TokenSuffix: suffix,
+			IsActive:    s.IsActive,
+			CreatedAt:   s.CreatedAt,
+			ExpiresAt:   s.ExpiresAt,
+		})
+	}
+	return records
+}
@@ -0,0 +1,255 @@
+package export
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+
+	DefaultTTL  = 24 * time.Hour
+	maxParallel = 2
+)
+
+var (
+	ErrNotFound = errors.New("export not found")
+	ErrNotReady = errors.New("export is not ready yet")
+	ErrClosed   = errors.New("server is shutting down")
+)
+
+type Job struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	CreatedAt  time.Time `json:"created"`
+	FinishedAt time.Time `json:"finished,omitempty"`
+	ExpiresAt  time.Time `json:"expires,omitempty"`
+
+	userID string
+	login  string
+	path   string
+}
+
+// Manager собирает архивы с данными пользователя в фоне: сборка по большому аккаунту
+// может занять время, поэтому клиент получает id задачи и опрашивает ее статус.
+type Manager struct {
+	UserRepo  user.UserRepo
+	Sessions  *session.SessionsManager
+	ItemsRepo posts.ItemsRepo
+	Logger    *zap.SugaredLogger
+	Dir       string
+	TTL       time.Duration
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	sem    chan struct{}
+	closed bool
+	// running отменяет и дожидается выгрузок при остановке сервера
+	running sync.WaitGroup
+	stop    context.Context
+	cancel  context.CancelFunc
+}
+
+func NewManager(userRepo user.UserRepo, sm *session.SessionsManager, items posts.ItemsRepo, logger *zap.SugaredLogger, dir string) (*Manager, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "redditclone-exports")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if removed := removeStale(dir); removed > 0 {
+		logger.Infof("Удалено %d архивов выгрузки от прошлого запуска", removed)
+	}
+	stop, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		UserRepo:  userRepo,
+		Sessions:  sm,
+		ItemsRepo: items,
+		Logger:    logger,
+		Dir:       dir,
+		TTL:       DefaultTTL,
+		jobs:      make(map[string]*Job),
+		sem:       make(chan struct{}, maxParallel),
+		stop:      stop,
+		cancel:    cancel,
+	}, nil
+}
+
+// Close прерывает незавершенные выгрузки и ждет их горутины, чтобы хранилище
+// можно было закрыть. Новые выгрузки после Close сразу завершаются ошибкой.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.cancel()
+	m.running.Wait()
+}
+
+// Start ставит выгрузку в очередь. Если у пользователя уже есть незавершенная задача, возвращается она.
+func (m *Manager) Start(ctx context.Context, userID, login string) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanupLocked(time.Now())
+
+	for _, job := range m.jobs {
+		if job.userID == userID && (job.Status == StatusPending || job.Status == StatusRunning) {
+			return *job
+		}
+	}
+	job := &Job{
+		ID:        newJobID(),
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+		userID:    userID,
+		login:     login,
+	}
+	m.jobs[job.ID] = job
+	if m.closed {
+		m.finishLocked(job, StatusFailed, ErrClosed, 0)
+		return *job
+	}
+	// выгрузка переживает запрос: отмену запроса не наследуем, трассу - да.
+	// Прерывает ее только Close
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopRun := context.AfterFunc(m.stop, cancel)
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		defer cancel()
+		defer stopRun()
+		m.run(runCtx, job)
+	}()
+	return *job
+}
+
+func (m *Manager) Get(jobID, userID string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanupLocked(time.Now())
+	job, ok := m.jobs[jobID]
+	if !ok || job.userID != userID {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Open возвращает готовый архив; закрыть файл должен вызывающий.
+func (m *Manager) Open(jobID, userID string) (*os.File, Job, error) {
+	job, err := m.Get(jobID, userID)
+	if err != nil {
+		return nil, Job{}, err
+	}
+	if job.Status != StatusDone {
+		return nil, job, ErrNotReady
+	}
+	f, err := os.Open(job.path)
+	return f, job, err
+}
+
+func (m *Manager) run(ctx context.Context, job *Job) {
+	select {
+	case m.sem <- struct{}{}:
+		defer func() { <-m.sem }()
+	case <-ctx.Done():
+		m.setStatus(job, StatusFailed, ErrClosed, 0)
+		return
+	}
+
+	m.setStatus(job, StatusRunning, nil, 0)
+	path := filepath.Join(m.Dir, job.ID+".zip")
+	size, err := m.build(ctx, path, job.userID, job.login)
+	if err != nil {
+		_ = os.Remove(path)
+		if ctx.Err() != nil {
+			err = ErrClosed
+		}
+		m.Logger.Errorf("Выгрузка данных %s для %s не удалась: %v", job.ID, job.login, err)
+		m.setStatus(job, StatusFailed, err, 0)
+		return
+	}
+	m.mu.Lock()
+	job.path = path
+	m.mu.Unlock()
+	m.setStatus(job, StatusDone, nil, size)
+	m.Logger.Infof("Выгрузка данных %s для %s готова, %d байт", job.ID, job.login, size)
+}
+
+func (m *Manager) setStatus(job *Job, status string, err error, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finishLocked(job, status, err, size)
+}
+
+func (m *Manager) finishLocked(job *Job, status string, err error, size int64) {
+	job.Status = status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if status == StatusDone || status == StatusFailed {
+		job.Size = size
+		job.FinishedAt = time.Now()
+		job.ExpiresAt = job.FinishedAt.Add(m.TTL)
+	}
+}
+
+func (m *Manager) cleanupLocked(now time.Time) {
+	for id, job := range m.jobs {
+		if job.ExpiresAt.IsZero() || now.Before(job.ExpiresAt) {
+			continue
+		}
+		if job.path != "" {
+			_ = os.Remove(job.path)
+		}
+		delete(m.jobs, id)
+	}
+}
+
+// removeStale удаляет архивы, оставшиеся от прошлого запуска: задачи хранятся только
+// в памяти, так что скачать их уже нельзя. Чужие файлы в каталоге не трогаем.
+func removeStale(dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".zip")
+		if !ok || !entry.Type().IsRegular() || !isJobID(id) {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, entry.Name())) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+func isJobID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,193 @@
+package export
+
+import (
+	"archive/zip"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/storage"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestManager(t *testing.T) (*Manager, user.User) {
+	t.Helper()
+	db, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	users := user.NewUserMemoryRepo(db)
+	u, err := users.SignUp(context.Background(), "alice", "secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(users, session.NewSessionsManager(db), posts.NewSQLRepo(db), zap.NewNop().Sugar(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, u
+}
+
+func waitJob(t *testing.T, m *Manager, id, userID string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(id, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == StatusDone || job.Status == StatusFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestExportBuildsArchive(t *testing.T) {
+	m, u := newTestManager(t)
+	userID := strconv.Itoa(u.ID)
+	job := waitJob(t, m, m.Start(context.Background(), userID, u.Login).ID, userID)
+	if job.Status != StatusDone {
+		t.Fatalf("job failed: %s", job.Error)
+	}
+	f, _, err := m.Open(job.ID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	zr, err := zip.OpenReader(filepath.Join(m.Dir, job.ID+".zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 5 {
+		t.Errorf("archive has %d files, want 5", len(zr.File))
+	}
+	if _, err = m.Get(job.ID, "someone-else"); err != ErrNotFound {
+		t.Errorf("another user got the job: %v", err)
+	}
+	m.Close()
+}
+
+// В выгрузку попадают черновики и скрытые модерацией посты вместе с комментариями и голосами на них.
+func TestExportIncludesRemovedPostsAndDrafts(t *testing.T) {
+	m, u := newTestManager(t)
+	defer m.Close()
+	ctx := context.Background()
+	userID := strconv.Itoa(u.ID)
+	me := posts.Author{ID: userID, Username: u.Login}
+	newPost := func() *posts.PostToFront {
+		return &posts.PostToFront{Author: me, Category: "music", Created: time.Now(), Title: "t", Type: "text", Text: "body", Votes: []*posts.Vote{}}
+	}
+
+	published := newPost()
+	m.ItemsRepo.AddPost(ctx, published)
+	removed := newPost()
+	m.ItemsRepo.AddPost(ctx, removed)
+	m.ItemsRepo.AddComment(ctx, removed.ID, posts.Comment{Author: me, Body: "hi", Created: time.Now()})
+	m.ItemsRepo.AddVote(ctx, removed.ID, userID, posts.Vote{User: userID, Vote: 1})
+	if _, ok := m.ItemsRepo.SetRemoved(ctx, removed.ID, true); !ok {
+		t.Fatal("SetRemoved failed")
+	}
+	draft := newPost()
+	m.ItemsRepo.AddDraft(ctx, draft, nil)
+
+	job := waitJob(t, m, m.Start(ctx, userID, u.Login).ID, userID)
+	if job.Status != StatusDone {
+		t.Fatalf("job failed: %s", job.Error)
+	}
+	zr, err := zip.OpenReader(filepath.Join(m.Dir, job.ID+".zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	counts := map[string]int{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var list []json.RawMessage
+		if err = json.NewDecoder(r).Decode(&list); err == nil {
+			counts[f.Name] = len(list)
+		}
+		r.Close()
+	}
+	if counts["posts.json"] != 3 || counts["comments.json"] != 1 || counts["votes.json"] != 1 {
+		t.Errorf("archive counts = %v", counts)
+	}
+}
+
+func TestCloseCancelsQueuedJobs(t *testing.T) {
+	m, u := newTestManager(t)
+	userID := strconv.Itoa(u.ID)
+	// все слоты заняты - задача ждет в очереди
+	for i := 0; i < cap(m.sem); i++ {
+		m.sem <- struct{}{}
+	}
+	job := m.Start(context.Background(), userID, u.Login)
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	got, err := m.Get(job.ID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusFailed || got.Error != ErrClosed.Error() {
+		t.Errorf("queued job after Close: %+v", got)
+	}
+	if _, err = os.Stat(filepath.Join(m.Dir, job.ID+".zip")); !os.IsNotExist(err) {
+		t.Errorf("interrupted archive was left behind: %v", err)
+	}
+
+	late := m.Start(context.Background(), userID, u.Login)
+	if late.Status != StatusFailed || late.Error != ErrClosed.Error() {
+		t.Errorf("job started after Close: %+v", late)
+	}
+}
+
+func TestNewManagerRemovesStaleArchives(t *testing.T) {
+	dir := t.TempDir()
+	stale := []string{newJobID() + ".zip", newJobID() + ".zip"}
+	kept := []string{"notes.zip", "abc.zip", newJobID() + ".tar", "README"}
+	for _, name := range append(append([]string{}, stale...), kept...) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, newJobID()+".zip"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewManager(nil, nil, nil, zap.NewNop().Sugar(), dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range stale {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+	for _, name := range kept {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
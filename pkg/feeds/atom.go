@@ -0,0 +1,81 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Author    atomPerson   `xml:"author"`
+	Category  atomCategory `xml:"category"`
+	Links     []atomLink   `xml:"link"`
+	Summary   atomText     `xml:"summary"`
+	Content   *atomText    `xml:"content,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func (f *Feed) Atom() ([]byte, error) {
+	feed := atomFeed{
+		ID:      f.SelfURL,
+		Title:   f.Title,
+		Updated: f.Updated().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.SelfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: make([]atomEntry, 0, len(f.Posts)),
+	}
+	for _, p := range f.Posts {
+		link := f.postLink(p)
+		entry := atomEntry{
+			ID:        link,
+			Title:     p.Title,
+			Published: p.Created.UTC().Format(time.RFC3339),
+			Updated:   p.Created.UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: p.Author.Username, URI: f.Link + "/u/" + p.Author.Username},
+			Category:  atomCategory{Term: p.Category},
+			Links:     []atomLink{{Href: link, Rel: "alternate", Type: "text/html"}},
+			Summary:   atomText{Type: "text", Body: summary(p)},
+		}
+		if p.Type == "link" && p.URL != "" {
+			entry.Links = append(entry.Links, atomLink{Href: p.URL, Rel: "related"})
+		}
+		if body := content(p); body != "" {
+			entry.Content = &atomText{Type: "text", Body: body}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshal(feed)
+}
@@ -0,0 +1,73 @@
+package feeds
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const MaxItems = 50
+
+type Feed struct {
+	Title   string
+	Link    string
+	SelfURL string
+	Posts   []*posts.Post
+}
+
+// NewFeed сортирует посты от новых к старым и оставляет не больше MaxItems.
+func NewFeed(title, link, selfURL string, items []*posts.Post) *Feed {
+	sorted := make([]*posts.Post, len(items))
+	copy(sorted, items)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+	if len(sorted) > MaxItems {
+		sorted = sorted[:MaxItems]
+	}
+	return &Feed{Title: title, Link: link, SelfURL: selfURL, Posts: sorted}
+}
+
+// Updated - время последнего изменения ленты: самый свежий пост или комментарий.
+func (f *Feed) Updated() time.Time {
+	var updated time.Time
+	for _, p := range f.Posts {
+		if p.Created.After(updated) {
+			updated = p.Created
+		}
+		for _, c := range p.Comments {
+			if c.Created.After(updated) {
+				updated = c.Created
+			}
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	return updated.UTC()
+}
+
+func (f *Feed) postLink(p *posts.Post) string {
+	return fmt.Sprintf("%s/a/%s/%s", f.Link, p.Category, p.ID)
+}
+
+func summary(p *posts.Post) string {
+	return fmt.Sprintf("score: %d, upvoted: %d%%, comments: %d", p.Score, p.UpvotePercentage, len(p.Comments))
+}
+
+func content(p *posts.Post) string {
+	if p.Type == "link" && p.URL != "" {
+		return p.URL
+	}
+	return p.Text
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
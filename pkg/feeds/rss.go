@@ -0,0 +1,83 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          rssSelf   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Comments    string  `xml:"comments"`
+	Description string  `xml:"description"`
+	Creator     string  `xml:"dc:creator"`
+	Category    string  `xml:"category"`
+	PubDate     string  `xml:"pubDate"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+func (f *Feed) RSS() ([]byte, error) {
+	feed := rss{
+		Version: "2.0",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Title,
+			LastBuildDate: f.Updated().Format(time.RFC1123Z),
+			Self:          rssSelf{Href: f.SelfURL, Rel: "self", Type: "application/rss+xml"},
+			Items:         make([]rssItem, 0, len(f.Posts)),
+		},
+	}
+	for _, p := range f.Posts {
+		postLink := f.postLink(p)
+		link := postLink
+		if p.Type == "link" && p.URL != "" {
+			link = p.URL
+		}
+		description := summary(p)
+		if body := content(p); body != "" {
+			description = body + "\n\n" + description
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       p.Title,
+			Link:        link,
+			Comments:    postLink,
+			Description: description,
+			Creator:     p.Author.Username,
+			Category:    p.Category,
+			PubDate:     p.Created.UTC().Format(time.RFC1123Z),
+			GUID:        rssGUID{IsPermaLink: true, Value: postLink},
+		})
+	}
+	return marshal(feed)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/logging"
+	"cmd/redditclone/pkg/posts"
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// duplicateWindow - в течение этого времени повторная отправка той же ссылки
+// в ту же категорию сопровождается предупреждением.
+const duplicateWindow = 30 * 24 * time.Hour
+
+type AddPostResponse struct {
+	*posts.PostToFront
+	Warning    string   `json:"warning,omitempty"`
+	Duplicates []string `json:"duplicates,omitempty"`
+}
+
+func (i *ItemsHandler) DomainPosts(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	logger.Info("DomainPosts start working")
+	host := posts.NormalizeHost(mux.Vars(req)["host"])
+
+	domainPosts := make([]*posts.PostToFront, 0)
+	for _, post := range i.ItemsRepo.GetAll(req.Context()) {
+		if post.LinkDomain() == host {
+			domainPosts = append(domainPosts, i.toFront(post))
+		}
+	}
+	sortNewestFirst(domainPosts)
+	logger.Infof("Отображены посты с домена %s", host)
+	writeJSON(w, req, http.StatusOK, domainPosts)
+}
+
+func (i *ItemsHandler) OtherDiscussions(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	logger.Info("OtherDiscussions start working")
+	postID := mux.Vars(req)["post_id"]
+	post, ok := i.ItemsRepo.FindPost(req.Context(), postID)
+	if !ok || !post.IsVisible() {
+		apierr.Write(w, req, errPostNotFound)
+		return
+	}
+
+	discussions := make([]*posts.PostToFront, 0)
+	if canonical := post.CanonicalURL(); canonical != "" {
+		for _, other := range i.ItemsRepo.GetAll(req.Context()) {
+			if other.ID != post.ID && other.CanonicalURL() == canonical {
+				discussions = append(discussions, i.toFront(other))
+			}
+		}
+	}
+	sortNewestFirst(discussions)
+	writeJSON(w, req, http.StatusOK, discussions)
+}
+
+// recentDuplicates ищет посты с той же нормализованной ссылкой в той же категории за duplicateWindow.
+func (i *ItemsHandler) recentDuplicates(ctx context.Context, category, rawURL string) []string {
+	canonical, err := posts.NormalizeURL(rawURL)
+	if err != nil {
+		return nil
+	}
+	since := time.Now().Add(-duplicateWindow)
+	var ids []string
+	for _, post := range i.ItemsRepo.GetAll(ctx) {
+		if post.Category == category && post.Created.After(since) && post.CanonicalURL() == canonical {
+			ids = append(ids, post.ID)
+		}
+	}
+	return ids
+}
+
+func sortNewestFirst(items []*posts.PostToFront) {
+	sort.Slice(items, func(a, b int) bool {
+		return items[a].Created.After(items[b].Created)
+	})
+}
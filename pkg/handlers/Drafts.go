@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/logging"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+type DraftForm struct {
+	AddPost
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+}
+
+type ScheduleForm struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+var (
+	errPastSchedule   = apierr.Validation(apierr.Field("publish_at", "must be in the future", nil))
+	errDraftPublished = apierr.Conflict("draft was already published")
+)
+
+func (i *ItemsHandler) AddDraft(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	logger.Info("AddDraft start working")
+	var form DraftForm
+	if !decodeJSON(w, req, &form) {
+		return
+	}
+	ss, err := session.SessionFromContext(req.Context())
+	if err != nil {
+		apierr.Write(w, req, errNoSession)
+		return
+	}
+	if form.PublishAt != nil && !form.PublishAt.After(time.Now()) {
+		apierr.Write(w, req, errPastSchedule)
+		return
+	}
+
+	draft := posts.PostToFront{
+		Author:   posts.Author{Username: ss.Login, ID: ss.UserID},
+		Category: form.Category,
+		Comments: make([]posts.Comment, 0),
+		Created:  time.Now(),
+		Title:    form.Title,
+		Type:     form.Type,
+		Text:     form.Text,
+		URL:      form.URL,
+		Votes:    []*posts.Vote{},
+	}
+	i.ItemsRepo.AddDraft(req.Context(), &draft, form.PublishAt)
+	logger.Infof("Черновик %s сохранен", draft.ID)
+	writeJSON(w, req, http.StatusCreated, &draft)
+}
+
+func (i *ItemsHandler) Drafts(w http.ResponseWriter, req *http.Request) {
+	ss, err := session.SessionFromContext(req.Context())
+	if err != nil {
+		apierr.Write(w, req, errNoSession)
+		return
+	}
+	drafts := i.ItemsRepo.GetDrafts(req.Context(), ss.UserID)
+	resp := make([]*posts.PostToFront, 0, len(drafts))
+	for _, draft := range drafts {
+		resp = append(resp, i.toFront(draft))
+	}
+	writeJSON(w, req, http.StatusOK, resp)
+}
+
+func (i *ItemsHandler) DraftInfo(w http.ResponseWriter, req *http.Request) {
+	draft, ok := i.ownDraft(w, req)
+	if !ok {
+		return
+	}
+	writeJSON(w, req, http.StatusOK, i.toFront(draft))
+}
+
+func (i *ItemsHandler) DraftUpdate(w http.ResponseWriter, req *http.Request) {
+	draft, ok := i.ownDraft(w, req)
+	if !ok {
+		return
+	}
+	var form AddPost
+	if !decodeJSON(w, req, &form) {
+		return
+	}
+	draft.Category = form.Category
+	draft.Title = form.Title
+	draft.Type = form.Type
+	draft.Text = form.Text
+	draft.URL = form.URL
+	if !i.ItemsRepo.UpdateDraft(req.Context(), draft) {
+		apierr.Write(w, req, errDraftPublished)
+		return
+	}
+	writeJSON(w, req, http.StatusOK, i.toFront(draft))
+}
+
+func (i *ItemsHandler) DraftDelete(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	draft, ok := i.ownDraft(w, req)
+	if !ok {
+		return
+	}
+	i.ItemsRepo.DeletePost(req.Context(), draft.ID)
+	logger.Infof("Черновик %s удален", draft.ID)
+	writeJSON(w, req, http.StatusOK, map[string]string{"message": "success"})
+}
+
+// DraftSchedule планирует публикацию; пустой publish_at снимает черновик с расписания.
+func (i *ItemsHandler) DraftSchedule(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	draft, ok := i.ownDraft(w, req)
+	if !ok {
+		return
+	}
+	var form ScheduleForm
+	if !decodeJSON(w, req, &form) {
+		return
+	}
+	if form.PublishAt != nil && !form.PublishAt.After(time.Now()) {
+		apierr.Write(w, req, errPastSchedule)
+		return
+	}
+	post, ok := i.ItemsRepo.SetDraftSchedule(req.Context(), draft.ID, form.PublishAt)
+	if !ok {
+		apierr.Write(w, req, errDraftPublished)
+		return
+	}
+	logger.Infof("Черновик %s запланирован на %v", draft.ID, form.PublishAt)
+	writeJSON(w, req, http.StatusOK, i.toFront(post))
+}
+
+func (i *ItemsHandler) DraftPublish(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	draft, ok := i.ownDraft(w, req)
+	if !ok {
+		return
+	}
+	post, ok := i.ItemsRepo.PublishDraft(req.Context(), draft.ID, time.Now())
+	if !ok {
+		apierr.Write(w, req, errDraftPublished)
+		return
+	}
+	logger.Infof("Черновик %s опубликован", draft.ID)
+	writeJSON(w, req, http.StatusOK, i.toFront(post))
+}
+
+// ownDraft находит неопубликованный пост текущего пользователя; чужие черновики не видны.
+func (i *ItemsHandler) ownDraft(w http.ResponseWriter, req *http.Request) (*posts.Post, bool) {
+	ss, err := session.SessionFromContext(req.Context())
+	if err != nil {
+		apierr.Write(w, req, errNoSession)
+		return nil, false
+	}
+	postID := mux.Vars(req)["post_id"]
+	post, ok := i.ItemsRepo.FindPost(req.Context(), postID)
+	if !ok || post.IsPublished() || post.Removed || post.Author.ID != ss.UserID {
+		apierr.Write(w, req, apierr.NotFound("draft not found"))
+		return nil, false
+	}
+	return post, true
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/events"
+	"cmd/redditclone/pkg/logging"
+	"cmd/redditclone/pkg/posts"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	sseHeartbeatInterval = 15 * time.Second
+	sseRetry             = 3 * time.Second
+)
+
+type EventsHandler struct {
+	Hub       *events.Hub
+	ItemsRepo posts.ItemsRepo
+}
+
+func (e *EventsHandler) PostEvents(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	postID := mux.Vars(req)["post_id"]
+	if post, ok := e.ItemsRepo.FindPost(req.Context(), postID); !ok || !post.IsVisible() {
+		apierr.Write(w, req, errPostNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierr.Write(w, req, apierr.Internal(errors.New("ResponseWriter не поддерживает Flush")))
+		return
+	}
+
+	lastEventID := req.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = req.URL.Query().Get("lastEventId")
+	}
+	// пропущенное отдается, только если клиент вернулся, пока топик не вытеснен из hub
+	lastID, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	sub, missed := e.Hub.Subscribe(events.PostTopic(postID), lastID)
+	defer sub.Close()
+
+	// поток живет дольше WriteTimeout сервера
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Error("sse write deadline: ", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil {
+		return
+	}
+	for _, ev := range missed {
+		if err := writeSSE(w, ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	logger.Infof("Подписка на события поста %s, пропущено %d", postID, len(missed))
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				// подписку закрыл hub: клиент не успевал читать или сервер останавливается
+				logger.Infof("Подписка на события поста %s закрыта", postID)
+				return
+			}
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev events.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+	return err
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/export"
+	"cmd/redditclone/pkg/logging"
+	"cmd/redditclone/pkg/session"
+	"errors"
+	"github.com/gorilla/mux"
+	"mime"
+	"net/http"
+)
+
+type ExportHandler struct {
+	Exports *export.Manager
+}
+
+type exportResponse struct {
+	export.Job
+	StatusURL   string `json:"status_url"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+func (e *ExportHandler) Start(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	ss, err := session.SessionFromContext(req.Context())
+	if err != nil {
+		apierr.Write(w, req, errNoSession)
+		return
+	}
+	job := e.Exports.Start(req.Context(), ss.UserID, ss.Login)
+	logger.Infof("Запрошена выгрузка данных %s пользователем %s", job.ID, ss.Login)
+
+	w.Header().Set("Location", "/api/me/export/"+job.ID)
+	writeJSON(w, req, http.StatusAccepted, newExportResponse(job))
+}
+
+func (e *ExportHandler) Status(w http.ResponseWriter, req *http.Request) {
+	ss, err := session.SessionFromContext(req.Context())
+	if err != nil {
+		apierr.Write(w, req, errNoSession)
+		return
+	}
+	job, err := e.Exports.Get(mux.Vars(req)["job_id"], ss.UserID)
+	if err != nil {
+		apierr.Write(w, req, apierr.NotFound(err.Error()))
+		return
+	}
+	writeJSON(w, req, http.StatusOK, newExportResponse(job))
+}
+
+func (e *ExportHandler) Download(w http.ResponseWriter, req *http.Request) {
+	ss, err := session.SessionFromContext(req.Context())
+	if err != nil {
+		apierr.Write(w, req, errNoSession)
+		return
+	}
+	f, job, err := e.Exports.Open(mux.Vars(req)["job_id"], ss.UserID)
+	switch {
+	case errors.Is(err, export.ErrNotFound):
+		apierr.Write(w, req, apierr.NotFound(err.Error()))
+		return
+	case errors.Is(err, export.ErrNotReady):
+		apierr.Write(w, req, apierr.Conflict(err.Error()))
+		return
+	case err != nil:
+		unavailable := apierr.New(http.StatusInternalServerError, apierr.CodeInternal, "export file is unavailable")
+		apierr.Write(w, req, unavailable.WithCause(err))
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": "redditclone-export-" + ss.Login + ".zip",
+	})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	http.ServeContent(w, req, "", job.FinishedAt, f)
+}
+
+func newExportResponse(job export.Job) exportResponse {
+	resp := exportResponse{Job: job, StatusURL: "/api/me/export/" + job.ID}
+	if job.Status == export.StatusDone {
+		resp.DownloadURL = resp.StatusURL + "/download"
+	}
+	return resp
+}
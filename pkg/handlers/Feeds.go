@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/feeds"
+	"cmd/redditclone/pkg/posts"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type FeedsHandler struct {
+	ItemsRepo posts.ItemsRepo
+
+	mu       sync.Mutex
+	versions map[string]feedVersion
+}
+
+// feedVersion - текущий вид ленты и время, когда он появился.
+type feedVersion struct {
+	etag     string
+	modified time.Time
+}
+
+// maxTrackedFeeds ограничивает память: ленту пользователя можно запросить по любому логину
+const maxTrackedFeeds = 10000
+
+func (f *FeedsHandler) All(w http.ResponseWriter, req *http.Request) {
+	base := baseURL(req)
+	feed := feeds.NewFeed("redditclone: all", base, base+req.URL.Path, f.ItemsRepo.GetAll(req.Context()))
+	f.serve(w, req, feed, "atom")
+}
+
+func (f *FeedsHandler) Category(w http.ResponseWriter, req *http.Request) {
+	category := mux.Vars(req)["category"]
+	base := baseURL(req)
+
+	var items []*posts.Post
+	for _, post := range f.ItemsRepo.GetAll(req.Context()) {
+		if post.Category == category {
+			items = append(items, post)
+		}
+	}
+	feed := feeds.NewFeed("redditclone: "+category, base+"/a/"+category, base+req.URL.Path, items)
+	f.serve(w, req, feed, "rss")
+}
+
+func (f *FeedsHandler) User(w http.ResponseWriter, req *http.Request) {
+	login := mux.Vars(req)["user_login"]
+	base := baseURL(req)
+
+	var items []*posts.Post
+	for _, post := range f.ItemsRepo.GetAll(req.Context()) {
+		if post.Author.Username == login {
+			items = append(items, post)
+		}
+	}
+	feed := feeds.NewFeed("redditclone: posts by "+login, base, base+req.URL.Path, items)
+	f.serve(w, req, feed, "atom")
+}
+
+// serve отдает ленту с ETag и Last-Modified; http.ServeContent сам отвечает 304
+// на If-None-Match и If-Modified-Since.
+func (f *FeedsHandler) serve(w http.ResponseWriter, req *http.Request, feed *feeds.Feed, format string) {
+	var (
+		body []byte
+		err  error
+	)
+	switch format {
+	case "rss":
+		body, err = feed.RSS()
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	default:
+		body, err = feed.Atom()
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	}
+	if err != nil {
+		apierr.Write(w, req, apierr.Internal(err))
+		return
+	}
+
+	sum := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	http.ServeContent(w, req, "", f.lastModified(req.URL.Path, etag, time.Now()), bytes.NewReader(body))
+}
+
+// lastModified - когда лента впервые отдана в нынешнем виде. Даты постов и комментариев
+// для этого не годятся: голоса, удаления и модерация меняют ленту, не трогая их. После
+// рестарта время начинается заново - клиент один раз получит ленту целиком, но не устаревшую.
+func (f *FeedsHandler) lastModified(path, etag string, now time.Time) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, ok := f.versions[path]
+	if ok && prev.etag == etag {
+		return prev.modified
+	}
+	if f.versions == nil || len(f.versions) >= maxTrackedFeeds {
+		f.versions = make(map[string]feedVersion)
+	}
+	// в HTTP-датах только секунды: новая версия должна быть строго позже прежней,
+	// иначе изменение в ту же секунду ответило бы 304
+	modified := now.Truncate(time.Second)
+	if ok && !modified.After(prev.modified) {
+		modified = prev.modified.Add(time.Second)
+	}
+	f.versions[path] = feedVersion{etag: etag, modified: modified}
+	return modified
+}
+
+func baseURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
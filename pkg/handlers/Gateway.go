@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/events"
+	"cmd/redditclone/pkg/logging"
+	"cmd/redditclone/pkg/session"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	wsWriteWait        = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingInterval     = wsPongWait * 9 / 10
+	wsMaxMessageSize   = 4096
+	wsSendBufferSize   = 256
+	wsMaxSubscriptions = 50
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+type wsRequest struct {
+	Action  string `json:"action"`
+	Channel string `json:"channel"`
+}
+
+type wsFrame struct {
+	Channel string          `json:"channel,omitempty"`
+	ID      uint64          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type wsClient struct {
+	conn      *websocket.Conn
+	hub       *events.Hub
+	out       chan wsFrame
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu   sync.Mutex
+	subs map[string]*events.Subscription
+}
+
+// Gateway - мультиплексированное WebSocket-подключение: клиент подписывается на каналы
+// category:<name>, post:<id> и user:<login> и получает события из всех них.
+func (e *EventsHandler) Gateway(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	ss, err := session.SessionFromContext(req.Context())
+	if err != nil {
+		apierr.Write(w, req, errNoSession)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		logger.Error("websocket upgrade: ", err)
+		return
+	}
+	logger.Infof("WebSocket подключение пользователя %s", ss.Login)
+
+	c := &wsClient{
+		conn: conn,
+		hub:  e.Hub,
+		out:  make(chan wsFrame, wsSendBufferSize),
+		done: make(chan struct{}),
+		subs: make(map[string]*events.Subscription),
+	}
+	go c.writeLoop()
+	c.readLoop()
+	c.close()
+	logger.Infof("WebSocket подключение пользователя %s закрыто", ss.Login)
+}
+
+func (c *wsClient) readLoop() {
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var msg wsRequest
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			switch err.(type) {
+			case *json.SyntaxError, *json.UnmarshalTypeError:
+				c.send(wsFrame{Type: "error", Error: "invalid json"})
+				continue
+			}
+			return
+		}
+		switch msg.Action {
+		case "subscribe":
+			c.subscribe(msg.Channel)
+		case "unsubscribe":
+			c.unsubscribe(msg.Channel)
+		default:
+			c.send(wsFrame{Type: "error", Error: "unknown action"})
+		}
+	}
+}
+
+func (c *wsClient) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer func() {
+		ping.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case <-c.done:
+			_ = c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+			return
+		case frame := <-c.out:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(frame); err != nil {
+				c.close()
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+func (c *wsClient) subscribe(channel string) {
+	if !events.ValidTopic(channel) {
+		c.send(wsFrame{Type: "error", Channel: channel, Error: "unknown channel"})
+		return
+	}
+	c.mu.Lock()
+	if _, ok := c.subs[channel]; ok {
+		c.mu.Unlock()
+		c.send(wsFrame{Type: "subscribed", Channel: channel})
+		return
+	}
+	if len(c.subs) >= wsMaxSubscriptions {
+		c.mu.Unlock()
+		c.send(wsFrame{Type: "error", Channel: channel, Error: "too many subscriptions"})
+		return
+	}
+	sub, _ := c.hub.Subscribe(channel, 0)
+	c.subs[channel] = sub
+	c.mu.Unlock()
+
+	c.send(wsFrame{Type: "subscribed", Channel: channel})
+	go c.forward(channel, sub)
+}
+
+func (c *wsClient) unsubscribe(channel string) {
+	c.mu.Lock()
+	sub, ok := c.subs[channel]
+	delete(c.subs, channel)
+	c.mu.Unlock()
+	if ok {
+		sub.Close()
+	}
+	c.send(wsFrame{Type: "unsubscribed", Channel: channel})
+}
+
+func (c *wsClient) forward(channel string, sub *events.Subscription) {
+	for ev := range sub.C {
+		c.send(wsFrame{Channel: channel, ID: ev.ID, Type: ev.Type, Data: ev.Data})
+	}
+	c.mu.Lock()
+	current, stillSubscribed := c.subs[channel]
+	c.mu.Unlock()
+	if stillSubscribed && current == sub {
+		// hub отключил подписку из-за переполнения - клиент не успевает читать
+		c.close()
+	}
+}
+
+// send не блокируется: если клиент не успевает забирать кадры, соединение закрывается.
+func (c *wsClient) send(frame wsFrame) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	select {
+	case c.out <- frame:
+	default:
+		c.close()
+	}
+}
+
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		subs := c.subs
+		c.subs = make(map[string]*events.Subscription)
+		c.mu.Unlock()
+		for _, sub := range subs {
+			sub.Close()
+		}
+		_ = c.conn.SetReadDeadline(time.Now())
+	})
+}
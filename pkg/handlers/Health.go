@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"cmd/redditclone/pkg/logging"
+	"context"
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultCheckTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	DB *gorm.DB
+	// Mongo - nil, если посты хранятся не в Mongo
+	Mongo   *mongo.Client
+	Timeout time.Duration
+}
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// Healthz - процесс жив и обслуживает HTTP; зависимости не проверяются.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Readyz параллельно пингует базы и отвечает 503, если хоть одна недоступна.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	checks := map[string]func(ctx context.Context) error{
+		h.DB.Dialect().GetName(): func(ctx context.Context) error { return h.DB.DB().PingContext(ctx) },
+	}
+	if h.Mongo != nil {
+		checks["mongo"] = func(ctx context.Context) error { return h.Mongo.Ping(ctx, nil) }
+	}
+
+	resp := readiness{Status: "ok", Checks: make(map[string]checkResult, len(checks))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			res := checkResult{Status: "up", LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Status, res.Error = "down", err.Error()
+			}
+			mu.Lock()
+			resp.Checks[name] = res
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for name, res := range resp.Checks {
+		if res.Status != "up" {
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			logger.Warnf("Проверка готовности: %s недоступен: %s", name, res.Error)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error(err)
+	}
+}
@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/logging"
 	"cmd/redditclone/pkg/posts"
 	"cmd/redditclone/pkg/session"
 	"cmd/redditclone/pkg/user"
+	"cmd/redditclone/pkg/validate"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
-	"go.uber.org/zap"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -15,6 +20,12 @@ type AddComment struct {
 	Comment string `json:"comment"`
 }
 
+func (c *AddComment) Validate() error {
+	var v validate.Validator
+	v.Field("comment", c.Comment, validate.Required, validate.MaxLen(2000))
+	return v.Err()
+}
+
 type AddPost struct {
 	Category string `json:"category"`
 	Title    string `json:"title"`
@@ -22,108 +33,121 @@ type AddPost struct {
 	URL      string `json:"url"`
 	Text     string `json:"text"`
 }
+
+func (p *AddPost) Normalize() {
+	p.Title = strings.TrimSpace(p.Title)
+	p.URL = strings.TrimSpace(p.URL)
+}
+
+// Validate: у поста-ссылки заполнен только url, у текстового - только text.
+func (p *AddPost) Validate() error {
+	var v validate.Validator
+	v.Field("category", p.Category, validate.Required, validate.OneOf(posts.Categories...))
+	v.Field("title", p.Title, validate.Required, validate.MaxLen(100))
+	v.Field("type", p.Type, validate.Required, validate.OneOf("link", "text"))
+	switch p.Type {
+	case "link":
+		v.Field("url", p.URL, validate.Required, validate.MaxLen(2048), validate.HTTPURL)
+		v.Field("text", p.Text, validate.Empty)
+	case "text":
+		v.Field("text", p.Text, validate.Required, validate.MinLen(4), validate.MaxLen(10000))
+		v.Field("url", p.URL, validate.Empty)
+	}
+	return v.Err()
+}
+
 type ItemsHandler struct {
-	UserRepo  *user.UserMemoryRepository
+	UserRepo  user.UserRepo
 	ItemsRepo posts.ItemsRepo
-	Logger    *zap.SugaredLogger
+	Archive   posts.ArchivePolicy
 }
 
-func (i *ItemsHandler) AddPost(post *posts.PostToFront, ss *session.Session) {
-	i.Logger.Info("Adding Post")
-	i.ItemsRepo.AddPost(post)
-	err := i.UserRepo.AddPost(ss.Login, post.ID)
-	if err != nil {
-		i.Logger.Error("Failed to add post", err)
-		return
+func (i *ItemsHandler) AddPost(ctx context.Context, post *posts.PostToFront, ss *session.Session) error {
+	logging.FromContext(ctx).Info("Adding Post")
+	i.ItemsRepo.AddPost(ctx, post)
+	if err := i.UserRepo.AddPost(ss.Login, post.ID); err != nil {
+		return fmt.Errorf("add post %s to user %s: %w", post.ID, ss.Login, err)
 	}
+	return nil
 }
 
-func (i *ItemsHandler) DeletePost(postID string, ss *session.Session) {
-	i.Logger.Info("Deleting Post")
-	i.ItemsRepo.DeletePost(postID)
-	err := i.UserRepo.DeletePost(ss.Login, postID)
-	if err != nil {
-		i.Logger.Error("Failed to add post", err)
-		return
+func (i *ItemsHandler) DeletePost(ctx context.Context, postID string, ss *session.Session) error {
+	logging.FromContext(ctx).Info("Deleting Post")
+	i.ItemsRepo.DeletePost(ctx, postID)
+	if err := i.UserRepo.DeletePost(ss.Login, postID); err != nil {
+		return fmt.Errorf("delete post %s of user %s: %w", postID, ss.Login, err)
 	}
+	return nil
 }
 
 func (i *ItemsHandler) PostsWithCategory(w http.ResponseWriter, req *http.Request) {
-	i.Logger.Info("PostsWithCategory start working")
+	logger := logging.FromContext(req.Context())
+	logger.Info("PostsWithCategory start working")
 	vars := mux.Vars(req)
 	category := vars["category"]
 
-	allPosts := i.ItemsRepo.GetAll()
+	allPosts := i.ItemsRepo.GetAll(req.Context())
 	postsCopy := make([]*posts.PostToFront, 0, len(allPosts))
 	if category != "" {
-		for i := 0; i < len(allPosts); i++ {
-			if allPosts[i].Category == category {
-				postToFront := posts.ConstructPostToFront(allPosts[i])
+		for k := 0; k < len(allPosts); k++ {
+			if allPosts[k].Category == category {
+				postToFront := i.toFront(allPosts[k])
 				postsCopy = append(postsCopy, postToFront)
 			}
 		}
 	} else {
-		for i := 0; i < len(allPosts); i++ {
-			postToFront := posts.ConstructPostToFront(allPosts[i])
+		for k := 0; k < len(allPosts); k++ {
+			postToFront := i.toFront(allPosts[k])
 			postsCopy = append(postsCopy, postToFront)
 		}
 	}
-	i.Logger.Infof("Отображены посты с категроией %s", category)
-	err := json.NewEncoder(w).Encode(postsCopy)
-	if err != nil {
-		i.Logger.Error(err)
-		return
-	}
+	logger.Infof("Отображены посты с категроией %s", category)
+	writeJSON(w, req, http.StatusOK, postsCopy)
 }
 
 func (i *ItemsHandler) PostInfo(w http.ResponseWriter, req *http.Request) {
-	i.Logger.Info("PostInfo start working")
+	logger := logging.FromContext(req.Context())
+	logger.Info("PostInfo start working")
 	vars := mux.Vars(req)
 	postID := vars["post_id"]
-	post, ok := i.ItemsRepo.FindPost(postID)
-	if !ok {
-		i.Logger.Infof("Пост  не найден %s", postID)
-		return
-	}
-	i.Logger.Infof("Отображен пост с id %s", postID)
-	w.Header().Set("Content-Type", "application/json; charset=utf-8\n\n")
-	err := json.NewEncoder(w).Encode(posts.ConstructPostToFront(post))
-	if err != nil {
-		i.Logger.Error(err)
+	post, ok := i.ItemsRepo.FindPost(req.Context(), postID)
+	if !ok || !post.IsVisible() {
+		apierr.Write(w, req, errPostNotFound)
 		return
 	}
-
+	logger.Infof("Отображен пост с id %s", postID)
+	writeJSON(w, req, http.StatusOK, i.toFront(post))
 }
 
 func (i *ItemsHandler) Posts(w http.ResponseWriter, req *http.Request) {
-	i.Logger.Info("Posts start working")
-	allPosts := i.ItemsRepo.GetAll()
+	logger := logging.FromContext(req.Context())
+	logger.Info("Posts start working")
+	allPosts := i.ItemsRepo.GetAll(req.Context())
 	postToFront := make([]*posts.PostToFront, 0, len(allPosts))
 	for _, post := range allPosts {
-		postToFront = append(postToFront, posts.ConstructPostToFront(post))
-	}
-
-	err := json.NewEncoder(w).Encode(postToFront)
-	if err != nil {
-		i.Logger.Error(err)
-		return
+		postToFront = append(postToFront, i.toFront(post))
 	}
+	writeJSON(w, req, http.StatusOK, postToFront)
 }
 
 func (i *ItemsHandler) AddPosts(w http.ResponseWriter, req *http.Request) {
-	i.Logger.Info("Add Posts start working")
+	logger := logging.FromContext(req.Context())
+	logger.Info("Add Posts start working")
 	var post AddPost
-	err := json.NewDecoder(req.Body).Decode(&post)
-	if err != nil {
-		i.Logger.Error(err)
+	if !decodeJSON(w, req, &post) {
 		return
 	}
 	ss, err := session.SessionFromContext(req.Context())
 	if err != nil {
-		i.Logger.Error(err)
+		apierr.Write(w, req, errNoSession)
 		return
 	}
 
+	var duplicates []string
+	if post.URL != "" {
+		duplicates = i.recentDuplicates(req.Context(), post.Category, post.URL)
+	}
+
 	aut := posts.Author{Username: ss.Login, ID: ss.UserID}
 	newPost := posts.PostToFront{
 		Author:           aut,
@@ -139,111 +163,175 @@ func (i *ItemsHandler) AddPosts(w http.ResponseWriter, req *http.Request) {
 		Views:            0,
 		Votes:            []*posts.Vote{},
 	}
-	i.AddPost(&newPost, ss)
-
-	err = json.NewEncoder(w).Encode(&newPost)
-	if err != nil {
-		i.Logger.Error(err)
+	if err = i.AddPost(req.Context(), &newPost, ss); err != nil {
+		apierr.Write(w, req, apierr.Internal(err))
 		return
 	}
+
+	resp := AddPostResponse{PostToFront: &newPost}
+	if len(duplicates) > 0 {
+		logger.Infof("Ссылка %s уже публиковалась в %s: %v", post.URL, post.Category, duplicates)
+		resp.Warning = "this link was already submitted to this category recently"
+		resp.Duplicates = duplicates
+	}
+	writeJSON(w, req, http.StatusCreated, &resp)
 }
 
 func (i *ItemsHandler) PostDelete(w http.ResponseWriter, req *http.Request) {
-	i.Logger.Info("PostDelete")
+	logger := logging.FromContext(req.Context())
+	logger.Info("PostDelete")
 	postID := mux.Vars(req)["post_id"]
 
 	ss, err := session.SessionFromContext(req.Context())
 	if err != nil {
-		i.Logger.Error(err)
+		apierr.Write(w, req, errNoSession)
 		return
 	}
-	post, ok := i.ItemsRepo.FindPost(postID)
+	post, ok := i.ItemsRepo.FindPost(req.Context(), postID)
 	if !ok {
-		i.Logger.Infof("Пост  не найден %s", postID)
+		apierr.Write(w, req, errPostNotFound)
 		return
 	}
-	if post.Author.ID == ss.UserID {
-		i.DeletePost(post.ID, ss)
-		i.Logger.Infof("Пост %s удален", postID)
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "success",
-		})
-	} else {
-		i.Logger.Infof("Пользователь не имеет права удалить пост %s", postID)
+	if post.Author.ID != ss.UserID {
+		apierr.Write(w, req, apierr.Forbidden("only the author can delete the post"))
+		return
+	}
+	if err = i.DeletePost(req.Context(), post.ID, ss); err != nil {
+		apierr.Write(w, req, apierr.Internal(err))
+		return
 	}
+	logger.Infof("Пост %s удален", postID)
+	writeJSON(w, req, http.StatusOK, map[string]string{
+		"message": "success",
+	})
 }
 
 func (i *ItemsHandler) UserPosts(w http.ResponseWriter, req *http.Request) {
-	i.Logger.Info("UserPosts start working")
+	logger := logging.FromContext(req.Context())
+	logger.Info("UserPosts start working")
 	username := mux.Vars(req)["user_login"]
 
-	postIDS := i.UserRepo.GetUserPosts(username)
-	userPosts := make([]*posts.PostToFront, 0, len(postIDS))
-	for k := 0; k < len(postIDS); k++ {
-		item, ok := i.ItemsRepo.FindPost(postIDS[k])
-		if !ok {
-			i.Logger.Infof("Пост %s не найден", k)
-			continue
+	// список берем из хранилища постов: туда попадают и опубликованные черновики,
+	// и посты, созданные до рестарта
+	userPosts := make([]*posts.PostToFront, 0)
+	for _, post := range i.ItemsRepo.GetAll(req.Context()) {
+		if post.Author.Username == username {
+			userPosts = append(userPosts, i.toFront(post))
 		}
-		postToFront := posts.ConstructPostToFront(item)
-		userPosts = append(userPosts, postToFront)
-
-	}
-
-	err := json.NewEncoder(w).Encode(userPosts)
-	if err != nil {
-		i.Logger.Error(err)
-		return
 	}
+	writeJSON(w, req, http.StatusOK, userPosts)
 }
 
 func (i *ItemsHandler) CommentAdd(w http.ResponseWriter, req *http.Request) {
-	i.Logger.Info("CommentAdd start working")
+	logger := logging.FromContext(req.Context())
+	logger.Info("CommentAdd start working")
 	comment := AddComment{}
-	err := json.NewDecoder(req.Body).Decode(&comment)
-	if err != nil {
-		i.Logger.Error(err)
+	if !decodeJSON(w, req, &comment) {
 		return
 	}
 
 	ss, err := session.SessionFromContext(req.Context())
 	if err != nil {
-		i.Logger.Error(err)
+		apierr.Write(w, req, errNoSession)
 		return
 	}
 
 	postID := mux.Vars(req)["post_id"]
-	post, ok := i.ItemsRepo.FindPost(postID)
-	if !ok {
-		i.Logger.Infof("Пост  не найден %s", postID)
+	if _, ok := i.openPost(w, req, postID); !ok {
 		return
 	}
 	aut := posts.Author{Username: ss.Login, ID: ss.UserID}
-	post = i.ItemsRepo.AddComment(postID, posts.Comment{Author: aut, Body: comment.Comment, Created: time.Now()})
-	postToFront := posts.ConstructPostToFront(post)
-	err = json.NewEncoder(w).Encode(*postToFront)
-	if err != nil {
-		i.Logger.Error(err)
+	post := i.ItemsRepo.AddComment(req.Context(), postID, posts.Comment{Author: aut, Body: comment.Comment, Created: time.Now()})
+	if post == nil {
+		apierr.Write(w, req, errPostNotFound)
 		return
 	}
-
+	logger.Infof("Комментарий к посту %s добавлен", postID)
+	writeJSON(w, req, http.StatusCreated, i.toFront(post))
 }
 func (i *ItemsHandler) CommentDelete(w http.ResponseWriter, req *http.Request) {
-	i.Logger.Info("CommentDelete start working")
+	logger := logging.FromContext(req.Context())
+	logger.Info("CommentDelete start working")
 	vars := mux.Vars(req)
 	postID := vars["post_id"]
 	commentID := vars["comment_id"]
 
-	post, ok := i.ItemsRepo.FindPost(postID)
+	ss, err := session.SessionFromContext(req.Context())
+	if err != nil {
+		apierr.Write(w, req, errNoSession)
+		return
+	}
+	post, ok := i.ItemsRepo.FindPost(req.Context(), postID)
 	if !ok {
-		i.Logger.Infof("Пост  не найден %s", postID)
+		apierr.Write(w, req, errPostNotFound)
 		return
 	}
-	post = i.ItemsRepo.DeleteComment(post.ID, commentID)
-	i.Logger.Infof("Комментарий %s удален", commentID)
-	err := json.NewEncoder(w).Encode(posts.ConstructPostToFront(post))
-	if err != nil {
-		i.Logger.Error(err)
+	comment, ok := post.Comments[commentID]
+	if !ok {
+		apierr.Write(w, req, apierr.NotFound("comment not found"))
+		return
+	}
+	if comment.Author.ID != ss.UserID {
+		apierr.Write(w, req, apierr.Forbidden("only the author can delete the comment"))
+		return
+	}
+	post = i.ItemsRepo.DeleteComment(req.Context(), post.ID, commentID)
+	if post == nil {
+		apierr.Write(w, req, errPostNotFound)
 		return
 	}
+	logger.Infof("Комментарий %s удален", commentID)
+	writeJSON(w, req, http.StatusOK, i.toFront(post))
+}
+
+// openPost находит опубликованный пост, который еще можно менять: голосовать и комментировать.
+func (i *ItemsHandler) openPost(w http.ResponseWriter, req *http.Request, postID string) (*posts.Post, bool) {
+	post, ok := i.ItemsRepo.FindPost(req.Context(), postID)
+	if !ok || !post.IsVisible() {
+		apierr.Write(w, req, errPostNotFound)
+		return nil, false
+	}
+	if i.Archive.IsArchived(post, time.Now()) {
+		apierr.Write(w, req, apierr.New(http.StatusForbidden, apierr.CodeArchived, posts.ErrArchived.Error()))
+		return nil, false
+	}
+	return post, true
+}
+
+// toFront отдает клиенту тот же признак архива, по которому openPost отказывает.
+func (i *ItemsHandler) toFront(post *posts.Post) *posts.PostToFront {
+	return i.Archive.ToFront(post, time.Now())
+}
+
+// Ошибки, которые отдают сразу несколько обработчиков
+var (
+	errNoSession    = apierr.Unauthorized("authorization required")
+	errPostNotFound = apierr.NotFound("post not found")
+)
+
+// decodeJSON разбирает тело запроса, нормализует и проверяет DTO. При ошибке ответ уже отправлен.
+func decodeJSON(w http.ResponseWriter, req *http.Request, dst interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(dst); err != nil {
+		apierr.Write(w, req, apierr.InvalidJSON(err))
+		return false
+	}
+	if n, ok := dst.(validate.Normalizer); ok {
+		n.Normalize()
+	}
+	if v, ok := dst.(validate.Validatable); ok {
+		if err := v.Validate(); err != nil {
+			apierr.Write(w, req, err)
+			return false
+		}
+	}
+	return true
+}
+
+// writeJSON - парный к apierr.Write ответ об успехе.
+func writeJSON(w http.ResponseWriter, req *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.FromContext(req.Context()).Error(err)
+	}
 }
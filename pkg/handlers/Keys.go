@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"cmd/redditclone/pkg/keys"
+	"net/http"
+)
+
+type KeysHandler struct {
+	Keys *keys.Manager
+}
+
+// JWKS отдает публичные ключи, которыми другие сервисы могут проверять наши токены.
+func (k *KeysHandler) JWKS(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, req, http.StatusOK, k.Keys.JWKS())
+}
@@ -1,9 +1,9 @@
 package handlers
 
 import (
+	"cmd/redditclone/pkg/apierr"
 	"cmd/redditclone/pkg/posts"
 	"cmd/redditclone/pkg/session"
-	"encoding/json"
 	"github.com/gorilla/mux"
 	"net/http"
 )
@@ -21,7 +21,11 @@ func ChangeVote(w http.ResponseWriter, req *http.Request, i *ItemsHandler, voteV
 
 	ss, err := session.SessionFromContext(req.Context())
 	if err != nil {
-		i.Logger.Error(err)
+		apierr.Write(w, req, errNoSession)
+		return
+	}
+
+	if _, ok := i.openPost(w, req, postID); !ok {
 		return
 	}
 
@@ -30,13 +34,12 @@ func ChangeVote(w http.ResponseWriter, req *http.Request, i *ItemsHandler, voteV
 		Vote: voteValue,
 	}
 
-	post := i.ItemsRepo.AddVote(postID, ss.UserID, newVote)
-
-	err = json.NewEncoder(w).Encode(posts.ConstructPostToFront(post))
-	if err != nil {
-		i.Logger.Error(err)
+	post := i.ItemsRepo.AddVote(req.Context(), postID, ss.UserID, newVote)
+	if post == nil || post.ID == "" {
+		apierr.Write(w, req, errPostNotFound)
 		return
 	}
+	writeJSON(w, req, http.StatusOK, i.toFront(post))
 }
 
 func (i *ItemsHandler) PostUnVote(w http.ResponseWriter, req *http.Request) {
@@ -44,15 +47,18 @@ func (i *ItemsHandler) PostUnVote(w http.ResponseWriter, req *http.Request) {
 
 	ss, err := session.SessionFromContext(req.Context())
 	if err != nil {
-		i.Logger.Error(err)
+		apierr.Write(w, req, errNoSession)
 		return
 	}
 
-	post := i.ItemsRepo.DeleteVote(postID, ss.UserID)
+	if _, ok := i.openPost(w, req, postID); !ok {
+		return
+	}
 
-	err = json.NewEncoder(w).Encode(posts.ConstructPostToFront(post))
-	if err != nil {
-		i.Logger.Error(err)
+	post := i.ItemsRepo.DeleteVote(req.Context(), postID, ss.UserID)
+	if post == nil || post.ID == "" {
+		apierr.Write(w, req, errPostNotFound)
 		return
 	}
+	writeJSON(w, req, http.StatusOK, i.toFront(post))
 }
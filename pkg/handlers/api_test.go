@@ -0,0 +1,372 @@
+package handlers_test
+
+import (
+	"bytes"
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/export"
+	"cmd/redditclone/pkg/handlers"
+	"cmd/redditclone/pkg/keys"
+	"cmd/redditclone/pkg/middleware"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/storage"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// testAPI - сервер с теми же маршрутами и middleware, что и в main, на SQLite в памяти.
+type testAPI struct {
+	handler  http.Handler
+	users    *user.UserMemoryRepository
+	sessions *session.SessionsManager
+	keys     *keys.Manager
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	db, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	signingKeys, err := keys.Load(keys.Source{Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.NewNop().Sugar()
+	users := user.NewUserMemoryRepo(db)
+	sm := session.NewSessionsManager(db)
+	items := posts.NewSQLRepo(db)
+
+	exports, err := export.NewManager(users, sm, items, logger, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// закрытый менеджер сразу проваливает выгрузки - так скачивание детерминированно дает 409
+	exports.Close()
+
+	userHandler := &handlers.UserHandler{
+		UserRepo:   users,
+		Sessions:   sm,
+		Keys:       signingKeys,
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: time.Hour,
+	}
+	exportHandler := &handlers.ExportHandler{Exports: exports}
+	itemsHandler := &handlers.ItemsHandler{
+		UserRepo:  users,
+		ItemsRepo: items,
+		// music архивируется сразу, остальные категории - никогда
+		Archive: posts.ArchivePolicy{PerCategory: map[string]time.Duration{"music": time.Nanosecond}},
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/login", userHandler.LoginPage)
+	r.HandleFunc("/api/register", userHandler.RegisterPage)
+	r.HandleFunc("/api/token/refresh", userHandler.RefreshToken).Methods(http.MethodPost)
+	r.HandleFunc("/api/posts", itemsHandler.AddPosts).Methods(http.MethodPost)
+	r.HandleFunc("/api/post/{post_id}", itemsHandler.PostInfo).Methods(http.MethodGet)
+	r.HandleFunc("/api/post/{post_id}", itemsHandler.CommentAdd).Methods(http.MethodPost)
+	r.HandleFunc("/api/post/{post_id}", itemsHandler.PostDelete).Methods(http.MethodDelete)
+	r.HandleFunc("/api/user/{user_login}", itemsHandler.UserPosts).Methods(http.MethodGet)
+	r.HandleFunc("/api/drafts", itemsHandler.AddDraft).Methods(http.MethodPost)
+	r.HandleFunc("/api/drafts/{post_id}/publish", itemsHandler.DraftPublish).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/export", exportHandler.Start).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/export/{job_id}/download", exportHandler.Download).Methods(http.MethodGet)
+
+	h := middleware.Auth(sm, signingKeys, 0, r)
+	h = middleware.Panic(h)
+	h = middleware.RequestID(logger, r, h)
+	return &testAPI{handler: h, users: users, sessions: sm, keys: signingKeys}
+}
+
+func (a *testAPI) do(t *testing.T, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (a *testAPI) register(t *testing.T, login string) handlers.TokenResponse {
+	t.Helper()
+	rec := a.do(t, http.MethodPost, "/api/register", "", `{"username":"`+login+`","password":"password1"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register %s: status %d, body %s", login, rec.Code, rec.Body)
+	}
+	var resp handlers.TokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func (a *testAPI) addPost(t *testing.T, token, category string) string {
+	t.Helper()
+	body := `{"category":"` + category + `","title":"hello","type":"text","text":"some text"}`
+	rec := a.do(t, http.MethodPost, "/api/posts", token, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add post: status %d, body %s", rec.Code, rec.Body)
+	}
+	var post struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&post); err != nil {
+		t.Fatal(err)
+	}
+	return post.ID
+}
+
+// decodeError проверяет, что ответ - ошибка в формате apierr с request_id из заголовка.
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) apierr.Error {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body %s", rec.Code, status, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var body apierr.Error
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if body.Code != code {
+		t.Errorf("code = %q, want %q", body.Code, code)
+	}
+	if body.Message == "" {
+		t.Error("empty message")
+	}
+	if id := rec.Header().Get(middleware.RequestIDHeader); body.RequestID == "" || body.RequestID != id {
+		t.Errorf("request_id = %q, header %q", body.RequestID, id)
+	}
+	return body
+}
+
+func TestInvalidJSON(t *testing.T) {
+	api := newTestAPI(t)
+	rec := api.do(t, http.MethodPost, "/api/login", "", `{"username":`)
+	decodeError(t, rec, http.StatusBadRequest, apierr.CodeInvalidJSON)
+}
+
+func TestValidationFields(t *testing.T) {
+	api := newTestAPI(t)
+	rec := api.do(t, http.MethodPost, "/api/register", "", `{"username":"bad name!","password":"short"}`)
+	body := decodeError(t, rec, http.StatusUnprocessableEntity, apierr.CodeValidation)
+
+	got := map[string]string{}
+	for _, f := range body.Fields {
+		if f.Location != "body" {
+			t.Errorf("field %s: location %q", f.Param, f.Location)
+		}
+		got[f.Param] = f.Msg
+	}
+	if len(got) != 2 || got["username"] == "" || got["password"] == "" {
+		t.Errorf("fields = %+v", body.Fields)
+	}
+	// пароль не возвращается клиенту даже в ошибке
+	if bytes.Contains(rec.Body.Bytes(), []byte("short")) {
+		t.Errorf("password echoed in %s", rec.Body)
+	}
+}
+
+func TestRegisterExisting(t *testing.T) {
+	api := newTestAPI(t)
+	api.register(t, "alice")
+	rec := api.do(t, http.MethodPost, "/api/register", "", `{"username":"alice","password":"password1"}`)
+	body := decodeError(t, rec, http.StatusUnprocessableEntity, apierr.CodeValidation)
+	if len(body.Fields) != 1 || body.Fields[0].Param != "username" {
+		t.Errorf("fields = %+v", body.Fields)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	api := newTestAPI(t)
+	api.register(t, "alice")
+
+	rec := api.do(t, http.MethodPost, "/api/login", "", `{"username":"alice","password":"wrong-pass"}`)
+	decodeError(t, rec, http.StatusUnauthorized, apierr.CodeInvalidCredentials)
+
+	if err := api.users.SetSuspended(context.Background(), "alice", true); err != nil {
+		t.Fatal(err)
+	}
+	rec = api.do(t, http.MethodPost, "/api/login", "", `{"username":"alice","password":"password1"}`)
+	decodeError(t, rec, http.StatusForbidden, apierr.CodeSuspended)
+}
+
+func TestAuthErrors(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register(t, "alice")
+	us, err := api.users.GetUser(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := middleware.GenerateJWTToken(us, api.keys, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := api.register(t, "bob")
+	if err = api.sessions.Destroy(context.Background(), revoked.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		code      string
+		challenge string
+	}{
+		{"missing", "", apierr.CodeUnauthorized, `Bearer realm="redditclone"`},
+		{"malformed", "not-a-jwt", apierr.CodeUnauthorized, `Bearer realm="redditclone", error="invalid_token"`},
+		{"tampered", alice.Token + "x", apierr.CodeUnauthorized, `Bearer realm="redditclone", error="invalid_token"`},
+		{"expired", expired, apierr.CodeTokenExpired, `Bearer realm="redditclone", error="invalid_token"`},
+		{"revoked", revoked.Token, apierr.CodeUnauthorized, `Bearer realm="redditclone", error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do(t, http.MethodPost, "/api/posts", tt.token, `{}`)
+			decodeError(t, rec, http.StatusUnauthorized, tt.code)
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+		})
+	}
+}
+
+func TestRefreshReuse(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register(t, "alice")
+	body := `{"refresh_token":"` + alice.RefreshToken + `"}`
+
+	rec := api.do(t, http.MethodPost, "/api/token/refresh", "", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first refresh: status %d, body %s", rec.Code, rec.Body)
+	}
+	rec = api.do(t, http.MethodPost, "/api/token/refresh", "", body)
+	decodeError(t, rec, http.StatusUnauthorized, apierr.CodeTokenReused)
+
+	rec = api.do(t, http.MethodPost, "/api/token/refresh", "", `{}`)
+	decodeError(t, rec, http.StatusUnprocessableEntity, apierr.CodeValidation)
+}
+
+func TestPostErrors(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register(t, "alice")
+	bob := api.register(t, "bob")
+	postID := api.addPost(t, alice.Token, "funny")
+	archivedID := api.addPost(t, alice.Token, "music")
+
+	t.Run("not found", func(t *testing.T) {
+		rec := api.do(t, http.MethodGet, "/api/post/000000000000000000000000", "", "")
+		decodeError(t, rec, http.StatusNotFound, apierr.CodeNotFound)
+	})
+	t.Run("forbidden", func(t *testing.T) {
+		rec := api.do(t, http.MethodDelete, "/api/post/"+postID, bob.Token, "")
+		decodeError(t, rec, http.StatusForbidden, apierr.CodeForbidden)
+	})
+	t.Run("archived", func(t *testing.T) {
+		rec := api.do(t, http.MethodPost, "/api/post/"+archivedID, bob.Token, `{"comment":"late"}`)
+		decodeError(t, rec, http.StatusForbidden, apierr.CodeArchived)
+	})
+	t.Run("author deletes", func(t *testing.T) {
+		rec := api.do(t, http.MethodDelete, "/api/post/"+postID, alice.Token, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestUserPosts(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register(t, "alice")
+	first := api.addPost(t, alice.Token, "funny")
+	second := api.addPost(t, alice.Token, "news")
+	rec := api.do(t, http.MethodDelete, "/api/post/"+second, alice.Token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	// опубликованный черновик попадает в список автора так же, как обычный пост
+	rec = api.do(t, http.MethodPost, "/api/drafts", alice.Token, `{"category":"funny","title":"draft","type":"text","text":"some text"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add draft: status %d, body %s", rec.Code, rec.Body)
+	}
+	var draft struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&draft); err != nil {
+		t.Fatal(err)
+	}
+	rec = api.do(t, http.MethodPost, "/api/drafts/"+draft.ID+"/publish", alice.Token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("publish: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		login string
+		want  []string
+	}{
+		{"alice", []string{first, draft.ID}},
+		// пользователь, который ни разу не писал, - пустой список, а не паника
+		{"nobody", []string{}},
+	}
+	for _, tt := range tests {
+		rec = api.do(t, http.MethodGet, "/api/user/"+tt.login, "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", tt.login, rec.Code, rec.Body)
+		}
+		var list []struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(list))
+		for _, p := range list {
+			got = append(got, p.ID)
+		}
+		sort.Strings(got)
+		sort.Strings(tt.want)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: posts = %+v, want %v", tt.login, list, tt.want)
+		}
+	}
+}
+
+func TestExportNotReady(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.register(t, "alice")
+
+	rec := api.do(t, http.MethodPost, "/api/me/export", alice.Token, "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("start: status %d, body %s", rec.Code, rec.Body)
+	}
+	var job export.Job
+	if err := json.NewDecoder(rec.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	rec = api.do(t, http.MethodGet, "/api/me/export/"+job.ID+"/download", alice.Token, "")
+	decodeError(t, rec, http.StatusConflict, apierr.CodeConflict)
+
+	// чужая выгрузка не отличается от несуществующей
+	bob := api.register(t, "bob")
+	rec = api.do(t, http.MethodGet, "/api/me/export/"+job.ID+"/download", bob.Token, "")
+	decodeError(t, rec, http.StatusNotFound, apierr.CodeNotFound)
+}
@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"cmd/redditclone/pkg/handlers"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/storage"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestFeedConditionalGet(t *testing.T) {
+	db, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	items := posts.NewSQLRepo(db)
+	ctx := context.Background()
+	author := posts.Author{ID: "1", Username: "alice"}
+	var ids []string
+	for _, title := range []string{"first", "second"} {
+		post := &posts.PostToFront{Author: author, Category: "news", Created: time.Now().Add(-time.Hour), Title: title, Type: "text", Text: "body", Votes: []*posts.Vote{}}
+		items.AddPost(ctx, post)
+		ids = append(ids, post.ID)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/feeds/{category}.rss", (&handlers.FeedsHandler{ItemsRepo: items}).Category)
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/feeds/news.rss", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("", "")
+	if first.Code != http.StatusOK {
+		t.Fatalf("status %d", first.Code)
+	}
+	etag, modified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("ETag %q, Last-Modified %q", etag, modified)
+	}
+	if rec := get("If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: status %d", rec.Code)
+	}
+	if rec := get("If-Modified-Since", modified); rec.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: status %d", rec.Code)
+	}
+
+	// модерация не меняет дат в ленте, но клиент с прежним If-Modified-Since должен получить новую
+	if _, ok := items.SetRemoved(ctx, ids[1], true); !ok {
+		t.Fatal("SetRemoved failed")
+	}
+	rec := get("If-Modified-Since", modified)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("after removal: status %d", rec.Code)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Error("ETag did not change")
+	}
+	before, _ := http.ParseTime(modified)
+	after, err := http.ParseTime(rec.Header().Get("Last-Modified"))
+	if err != nil || !after.After(before) {
+		t.Errorf("Last-Modified %v, was %v", after, before)
+	}
+	if rec = get("If-Modified-Since", rec.Header().Get("Last-Modified")); rec.Code != http.StatusNotModified {
+		t.Errorf("new Last-Modified: status %d", rec.Code)
+	}
+}
@@ -1,90 +1,300 @@
 package handlers
 
 import (
+	"cmd/redditclone/pkg/account"
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/keys"
+	"cmd/redditclone/pkg/logging"
 	"cmd/redditclone/pkg/middleware"
 	"cmd/redditclone/pkg/session"
 	"cmd/redditclone/pkg/user"
-	"encoding/json"
-	"go.uber.org/zap"
-	"log"
+	"cmd/redditclone/pkg/validate"
+	"errors"
 	"net/http"
+	"regexp"
 	"strconv"
+	"time"
 )
 
 type UserHandler struct {
-	Logger   *zap.SugaredLogger
-	UserRepo user.UserRepo
-	Sessions *session.SessionsManager
+	UserRepo   user.UserRepo
+	Sessions   *session.SessionsManager
+	Deleter    *account.Deleter
+	Keys       *keys.Manager
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
 }
 
+// refreshCookie доступна только эндпоинту обновления и не видна JavaScript.
+const refreshCookie = "refresh_token"
+
+// TokenResponse - ответ входа, регистрации и обновления; token читает фронтенд.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type RefreshForm struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+var errSuspended = apierr.New(http.StatusForbidden, apierr.CodeSuspended, "account is suspended")
+
 type LoginForm struct {
 	Login    string `json:"username"`
 	Password string `json:"password"`
 }
 
+func (f *LoginForm) Normalize() {
+	f.Login = validate.Username(f.Login)
+}
+
+// Validate для входа проверяет только наличие полей: правила регистрации
+// могли ужесточиться после того, как пользователь завел аккаунт.
+func (f *LoginForm) Validate() error {
+	var v validate.Validator
+	v.Field("username", f.Login, validate.Required)
+	v.Secret("password", f.Password, validate.Required)
+	return v.Err()
+}
+
+type RegisterForm struct {
+	LoginForm
+}
+
+var usernameChars = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func (f *RegisterForm) Validate() error {
+	var v validate.Validator
+	v.Field("username", f.Login, validate.Required, validate.MaxLen(32),
+		validate.Matches(usernameChars, "contains invalid characters"))
+	v.Secret("password", f.Password, validate.Password()...)
+	return v.Err()
+}
+
+type DeleteAccountForm struct {
+	Password string `json:"password"`
+	Mode     string `json:"mode"`
+}
+
+func (f *DeleteAccountForm) Validate() error {
+	var v validate.Validator
+	v.Secret("password", f.Password, validate.Required)
+	v.Field("mode", f.Mode, validate.OneOf(account.ModeAnonymize, account.ModeRemove))
+	return v.Err()
+}
+
 func (u *UserHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	userData := &LoginForm{}
-	err := json.NewDecoder(r.Body).Decode(userData)
-	if err != nil {
-		middleware.JSONError(w, http.StatusBadRequest, err.Error())
+	if !decodeJSON(w, r, userData) {
 		return
 	}
-	us, err := u.UserRepo.Authorize(userData.Login, userData.Password)
-	if err != nil {
-		middleware.JSONError(w, http.StatusUnauthorized, err.Error())
+	us, err := u.UserRepo.Authorize(r.Context(), userData.Login, userData.Password)
+	switch {
+	case errors.Is(err, user.ErrBadCredentials):
+		apierr.Write(w, r, apierr.New(http.StatusUnauthorized, apierr.CodeInvalidCredentials, "invalid login or password"))
+		return
+	case errors.Is(err, user.ErrSuspended):
+		apierr.Write(w, r, errSuspended)
+		return
+	case err != nil:
+		apierr.Write(w, r, apierr.Internal(err))
 		return
 	}
 	err = u.Sessions.DestroyCurrent(w, r)
 	if err != nil {
-		log.Println(err)
+		logger.Debug(err)
+	}
+
+	resp, err := u.startFamily(w, r, us)
+	if err != nil {
+		apierr.Write(w, r, apierr.Internal(err))
+		return
 	}
+	logger.Infof("Пользователь авторизовался %v", us)
+	writeJSON(w, r, http.StatusOK, resp)
+}
 
-	resp, token, err := middleware.GenerateJWTToken(w, us)
+func (u *UserHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userData := &RegisterForm{}
+	if !decodeJSON(w, r, userData) {
+		return
+	}
+	us, err := u.UserRepo.SignUp(r.Context(), userData.Login, userData.Password)
+	if errors.Is(err, user.ErrExists) {
+		apierr.Write(w, r, apierr.Validation(apierr.Field("username", "already exists", userData.Login)))
+		return
+	}
 	if err != nil {
+		apierr.Write(w, r, apierr.Internal(err))
 		return
 	}
-	_, err = u.Sessions.Create(w, token, strconv.Itoa(us.ID), us.Login)
+
+	logger.Infof("Пользователь зарегистрировался %v", us)
+	err = u.Sessions.DestroyCurrent(w, r)
 	if err != nil {
-		log.Println(err)
+		logger.Debug(err)
 	}
-	u.Logger.Infof("Пользователь авторизовался %v", us)
-	_, err = w.Write(resp)
+	resp, err := u.startFamily(w, r, us)
 	if err != nil {
-		log.Println(err)
+		apierr.Write(w, r, apierr.Internal(err))
 		return
 	}
+	writeJSON(w, r, http.StatusCreated, resp)
 }
 
-func (u *UserHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
-	userData := &LoginForm{}
-	err := json.NewDecoder(r.Body).Decode(userData)
-	if err != nil {
-		middleware.JSONError(w, http.StatusBadRequest, err.Error())
+// RefreshToken обменивает refresh-токен (из тела или cookie) на новую пару токенов.
+func (u *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	form := &RefreshForm{}
+	if r.ContentLength != 0 && !decodeJSON(w, r, form) {
 		return
 	}
-	us, err := u.UserRepo.SignUp(userData.Login, userData.Password)
-	if err != nil {
-		middleware.JSONError(w, http.StatusUnauthorized, err.Error())
+	if form.RefreshToken == "" {
+		if cookie, err := r.Cookie(refreshCookie); err == nil {
+			form.RefreshToken = cookie.Value
+		}
+	}
+	if form.RefreshToken == "" {
+		apierr.Write(w, r, apierr.Validation(apierr.Field("refresh_token", "required", nil)))
+		return
 	}
 
-	resp, token, err := middleware.GenerateJWTToken(w, us)
+	old, refresh, err := u.Sessions.Rotate(r.Context(), form.RefreshToken, u.RefreshTTL)
+	switch {
+	case errors.Is(err, session.ErrRefreshReused):
+		logger.Warnw("Повторно предъявлен refresh-токен, семейство отозвано", "family_id", old.FamilyID, "login", old.Login)
+		clearRefreshCookie(w)
+		apierr.Write(w, r, apierr.New(http.StatusUnauthorized, apierr.CodeTokenReused, "refresh token was already used; the session is revoked"))
+		return
+	case errors.Is(err, session.ErrRefreshExpired):
+		clearRefreshCookie(w)
+		apierr.Write(w, r, apierr.New(http.StatusUnauthorized, apierr.CodeTokenExpired, "refresh token expired"))
+		return
+	case errors.Is(err, session.ErrRefreshInvalid):
+		clearRefreshCookie(w)
+		apierr.Write(w, r, apierr.Unauthorized("invalid refresh token"))
+		return
+	case err != nil:
+		apierr.Write(w, r, apierr.Internal(err))
+		return
+	}
+
+	// за время жизни семейства аккаунт могли заблокировать или удалить
+	us, err := u.UserRepo.GetUser(r.Context(), old.Login)
+	if err != nil || us.Suspended || strconv.Itoa(us.ID) != old.UserID {
+		if revokeErr := u.Sessions.RevokeFamily(r.Context(), old.FamilyID); revokeErr != nil {
+			logger.Error(revokeErr)
+		}
+		clearRefreshCookie(w)
+		if err == nil && us.Suspended {
+			apierr.Write(w, r, errSuspended)
+			return
+		}
+		apierr.Write(w, r, apierr.Unauthorized("invalid refresh token"))
+		return
+	}
+
+	resp, err := u.issueTokens(w, r, us, old.FamilyID, refresh)
 	if err != nil {
-		log.Println(err)
+		apierr.Write(w, r, apierr.Internal(err))
 		return
 	}
-	u.Logger.Infof("Пользователь зарегистрировался %v", us)
-	err = u.Sessions.DestroyCurrent(w, r)
+	logger.Infof("Токен пользователя %s обновлен", us.Login)
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// startFamily начинает новое семейство refresh-токенов при входе.
+func (u *UserHandler) startFamily(w http.ResponseWriter, r *http.Request, us user.User) (*TokenResponse, error) {
+	familyID, err := session.NewFamilyID()
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
-	_, err = u.Sessions.Create(w, token, strconv.Itoa(us.ID), us.Login)
+	refresh, err := u.Sessions.IssueRefresh(r.Context(), familyID, strconv.Itoa(us.ID), us.Login, u.RefreshTTL)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
+	return u.issueTokens(w, r, us, familyID, refresh)
+}
 
-	_, err = w.Write(resp)
+// issueTokens выпускает access-токен с сессией в семействе familyID и ставит cookie.
+func (u *UserHandler) issueTokens(w http.ResponseWriter, r *http.Request, us user.User, familyID, refresh string) (*TokenResponse, error) {
+	token, expiresAt, err := middleware.GenerateJWTToken(us, u.Keys, u.AccessTTL)
 	if err != nil {
-		log.Println(err)
+		return nil, err
+	}
+	sess := session.NewSession(strconv.Itoa(us.ID), us.Login, familyID, expiresAt)
+	sess.Token = token
+	if err = u.Sessions.Create(r.Context(), w, sess); err != nil {
+		return nil, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    refresh,
+		Path:     "/api/token",
+		Expires:  time.Now().Add(u.RefreshTTL),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return &TokenResponse{Token: token, RefreshToken: refresh, ExpiresIn: int(u.AccessTTL.Seconds())}, nil
+}
+
+func clearRefreshCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:    refreshCookie,
+		Path:    "/api/token",
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	})
+}
+
+// DeleteAccount удаляет аккаунт после подтверждения паролем. Посты и комментарии
+// либо обезличиваются, либо удаляются - по выбору пользователя.
+func (u *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	form := &DeleteAccountForm{Mode: account.ModeAnonymize}
+	if !decodeJSON(w, r, form) {
+		return
+	}
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		apierr.Write(w, r, errNoSession)
+		return
+	}
+	_, err = u.UserRepo.Authorize(r.Context(), sess.Login, form.Password)
+	switch {
+	case errors.Is(err, user.ErrBadCredentials):
+		apierr.Write(w, r, apierr.New(http.StatusForbidden, apierr.CodeInvalidCredentials, "wrong password"))
+		return
+	case errors.Is(err, user.ErrSuspended):
+		apierr.Write(w, r, errSuspended)
+		return
+	case err != nil:
+		apierr.Write(w, r, apierr.Internal(err))
+		return
 	}
 
+	err = u.Deleter.Delete(r.Context(), sess.UserID, sess.Login, form.Mode)
+	if errors.Is(err, account.ErrInProgress) {
+		apierr.Write(w, r, apierr.Conflict(err.Error()))
+		return
+	}
+	if err != nil {
+		interrupted := apierr.New(http.StatusInternalServerError, apierr.CodeInternal, "account deletion was interrupted and will be resumed")
+		apierr.Write(w, r, interrupted.WithCause(err))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:    "token",
+		Path:    "/",
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	})
+	clearRefreshCookie(w)
+	logger.Infof("Пользователь удалил аккаунт %s", sess.Login)
+	writeJSON(w, r, http.StatusOK, map[string]string{"message": "success"})
 }
@@ -0,0 +1,271 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// SecretKeyID - kid ключа из jwt_secret. Им же проверяются токены без kid,
+	// выпущенные до появления менеджера ключей.
+	SecretKeyID = "secret"
+
+	minSecretLen = 32
+	minRSABits   = 2048
+)
+
+var kidPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrWrongAlg   = errors.New("token algorithm does not match the key")
+)
+
+// Key - ключ подписи. У ключа, загруженного из публичного PEM, нет приватной части:
+// он только проверяет токены, выпущенные другим сервисом.
+type Key struct {
+	ID        string
+	Algorithm string
+	method    jwt.SigningMethod
+	sign      interface{}
+	verify    interface{}
+}
+
+func (k *Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// Public - публичная часть асимметричного ключа; у HS256 ее нет.
+func (k *Key) Public() crypto.PublicKey {
+	switch v := k.verify.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return v
+	}
+	return nil
+}
+
+// Source - откуда брать ключи. Retired - kid через запятую: такие ключи не загружаются,
+// и подписанные ими токены больше не принимаются.
+type Source struct {
+	Secret  string
+	Dir     string
+	Active  string
+	Retired string
+}
+
+// Manager подписывает активным ключом и проверяет любым загруженным.
+type Manager struct {
+	keys   map[string]*Key
+	active *Key
+}
+
+// Load собирает ключи из jwt_secret и каталога. В каталоге kid - имя файла без расширения:
+// <kid>.secret - секрет HS256, <kid>.pem - приватный ключ RSA (RS256) или Ed25519 (EdDSA)
+// в PKCS#8/PKCS#1 либо публичный ключ в PKIX.
+func Load(src Source) (*Manager, error) {
+	retired := map[string]bool{}
+	for _, kid := range strings.Split(src.Retired, ",") {
+		if kid = strings.TrimSpace(kid); kid != "" {
+			retired[kid] = true
+		}
+	}
+
+	m := &Manager{keys: map[string]*Key{}}
+	if src.Secret != "" && !retired[SecretKeyID] {
+		key, err := NewHMAC(SecretKeyID, []byte(src.Secret))
+		if err != nil {
+			return nil, fmt.Errorf("jwt_secret: %w", err)
+		}
+		m.keys[key.ID] = key
+	}
+	if src.Dir != "" {
+		loaded, err := loadDir(src.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range loaded {
+			if retired[key.ID] {
+				continue
+			}
+			if _, ok := m.keys[key.ID]; ok {
+				return nil, fmt.Errorf("duplicate key id %q", key.ID)
+			}
+			m.keys[key.ID] = key
+		}
+	}
+
+	active := src.Active
+	if active == "" && len(m.keys) == 1 {
+		for kid := range m.keys {
+			active = kid
+		}
+	}
+	if active == "" {
+		return nil, errors.New("jwt_active_key is required when several keys are loaded")
+	}
+	if retired[active] {
+		return nil, fmt.Errorf("active key %q is retired", active)
+	}
+	key, ok := m.keys[active]
+	if !ok {
+		return nil, fmt.Errorf("active key %q is not loaded", active)
+	}
+	if !key.CanSign() {
+		return nil, fmt.Errorf("active key %q has no private part", active)
+	}
+	m.active = key
+	return m, nil
+}
+
+func NewHMAC(kid string, secret []byte) (*Key, error) {
+	if len(secret) < minSecretLen {
+		return nil, fmt.Errorf("key %s: HS256 secret must be at least %d bytes", kid, minSecretLen)
+	}
+	return &Key{ID: kid, Algorithm: jwt.SigningMethodHS256.Alg(), method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+}
+
+// NewAsymmetric принимает *rsa.PrivateKey, *rsa.PublicKey, ed25519.PrivateKey или ed25519.PublicKey.
+func NewAsymmetric(kid string, k interface{}) (*Key, error) {
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("key %s: RSA key must be at least %d bits", kid, minRSABits)
+		}
+		return &Key{ID: kid, Algorithm: jwt.SigningMethodRS256.Alg(), method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("key %s: RSA key must be at least %d bits", kid, minRSABits)
+		}
+		return &Key{ID: kid, Algorithm: jwt.SigningMethodRS256.Alg(), method: jwt.SigningMethodRS256, verify: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Algorithm: jwt.SigningMethodEdDSA.Alg(), method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Algorithm: jwt.SigningMethodEdDSA.Alg(), method: jwt.SigningMethodEdDSA, verify: k}, nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %T", kid, k)
+}
+
+func loadDir(dir string) ([]*Key, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("jwt_keys_dir: %w", err)
+	}
+	var loaded []*Key
+	for _, e := range entries {
+		// скрытые файлы и каталоги - служебные (например, ..data в смонтированном секрете Kubernetes)
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(e.Name())
+		kid := strings.TrimSuffix(e.Name(), ext)
+		if !kidPattern.MatchString(kid) {
+			return nil, fmt.Errorf("key file %s: id must match %s", e.Name(), kidPattern)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var key *Key
+		switch ext {
+		case ".secret":
+			key, err = NewHMAC(kid, []byte(strings.TrimSpace(string(data))))
+		case ".pem":
+			key, err = parsePEM(kid, data)
+		default:
+			return nil, fmt.Errorf("key file %s: expected .secret or .pem", e.Name())
+		}
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, key)
+	}
+	return loaded, nil
+}
+
+func parsePEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM block", kid)
+	}
+	var (
+		k   interface{}
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		k, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		k, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		k, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", kid, err)
+	}
+	return NewAsymmetric(kid, k)
+}
+
+// Sign подписывает claims активным ключом и пишет его kid в заголовок.
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.active.method, claims)
+	token.Header["kid"] = m.active.ID
+	return token.SignedString(m.active.sign)
+}
+
+// Keyfunc выбирает ключ по kid. Алгоритм токена должен совпадать с алгоритмом ключа:
+// иначе публичный RSA-ключ можно было бы подсунуть как секрет HS256.
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = SecretKeyID
+	}
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, ErrWrongAlg
+	}
+	return key.verify, nil
+}
+
+// Algorithms - алгоритмы загруженных ключей; остальные отвергаются до поиска ключа.
+func (m *Manager) Algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range m.keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+func (m *Manager) Active() *Key {
+	return m.active
+}
+
+// Keys возвращает загруженные ключи, отсортированные по kid.
+func (m *Manager) Keys() []*Key {
+	list := make([]*Key, 0, len(m.keys))
+	for _, key := range m.keys {
+		list = append(list, key)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].ID < list[b].ID })
+	return list
+}
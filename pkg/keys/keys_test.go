@@ -0,0 +1,309 @@
+package keys_test
+
+import (
+	"cmd/redditclone/pkg/keys"
+	"cmd/redditclone/pkg/middleware"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+type testDir struct {
+	path   string
+	rsa    *rsa.PrivateKey
+	ed     ed25519.PrivateKey
+	extPub *rsa.PublicKey
+}
+
+// newKeyDir кладет в каталог ключи всех поддерживаемых видов:
+// old.secret (HS256), rsa.pem и ed.pem (приватные), ext.pem (только публичный RSA).
+func newKeyDir(t *testing.T) testDir {
+	t.Helper()
+	d := testDir{path: t.TempDir()}
+	var err error
+	if d.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if _, d.ed, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	ext, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.extPub = &ext.PublicKey
+
+	writeFile(t, d.path, "old.secret", []byte("fedcba9876543210fedcba9876543210\n"))
+	writeFile(t, d.path, "rsa.pem", pemBlock(t, "PRIVATE KEY", d.rsa))
+	writeFile(t, d.path, "ed.pem", pemBlock(t, "PRIVATE KEY", d.ed))
+	writeFile(t, d.path, "ext.pem", pemBlock(t, "PUBLIC KEY", d.extPub))
+	return d
+}
+
+func pemBlock(t *testing.T, kind string, key interface{}) []byte {
+	t.Helper()
+	var (
+		der []byte
+		err error
+	)
+	if kind == "PUBLIC KEY" {
+		der, err = x509.MarshalPKIXPublicKey(key)
+	} else {
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func load(t *testing.T, src keys.Source) *keys.Manager {
+	t.Helper()
+	m, err := keys.Load(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func claims() middleware.Claims {
+	now := time.Now()
+	return middleware.Claims{
+		User: middleware.TokenUser{Username: "alice", ID: "7"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+// signWith подписывает токен в обход менеджера; пустой kid не пишется в заголовок.
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims())
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSignAndVerify(t *testing.T) {
+	d := newKeyDir(t)
+	for _, active := range []string{"rsa", "ed", "old", keys.SecretKeyID} {
+		t.Run(active, func(t *testing.T) {
+			m := load(t, keys.Source{Secret: testSecret, Dir: d.path, Active: active})
+			token, err := m.Sign(claims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &middleware.Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != active || parsed.Method.Alg() != m.Active().Algorithm {
+				t.Errorf("header = %v", parsed.Header)
+			}
+			if _, err = middleware.ParseJWTToken(token, m, 0); err != nil {
+				t.Errorf("parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	d := newKeyDir(t)
+	m := load(t, keys.Source{Secret: testSecret, Dir: d.path, Active: "rsa"})
+	rsaPub, err := x509.MarshalPKIXPublicKey(&d.rsa.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"no kid falls back to secret", signWith(t, jwt.SigningMethodHS256, "", []byte(testSecret)), true},
+		{"no kid with RS256", signWith(t, jwt.SigningMethodRS256, "", d.rsa), false},
+		// публичный ключ известен всем: подписанный им как секретом HS256 токен - подделка
+		{"HS256 with RSA public key", signWith(t, jwt.SigningMethodHS256, "rsa", rsaPub), false},
+		{"HS256 with RSA public PEM", signWith(t, jwt.SigningMethodHS256, "rsa", pemBlock(t, "PUBLIC KEY", &d.rsa.PublicKey)), false},
+		{"RS256 under secret kid", signWith(t, jwt.SigningMethodRS256, keys.SecretKeyID, d.rsa), false},
+		{"EdDSA under RSA kid", signWith(t, jwt.SigningMethodEdDSA, "rsa", d.ed), false},
+		{"foreign RSA key", signWith(t, jwt.SigningMethodRS256, "rsa", other), false},
+		{"unknown kid", signWith(t, jwt.SigningMethodHS256, "nope", []byte(testSecret)), false},
+		{"EdDSA", signWith(t, jwt.SigningMethodEdDSA, "ed", d.ed), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := middleware.ParseJWTToken(tt.token, m, 0)
+			if tt.ok && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, middleware.ErrBadToken) {
+				t.Errorf("err = %v, want %v", err, middleware.ErrBadToken)
+			}
+		})
+	}
+}
+
+func TestRetiredKey(t *testing.T) {
+	d := newKeyDir(t)
+	before := load(t, keys.Source{Secret: testSecret, Dir: d.path, Active: "old"})
+	token, err := before.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = middleware.ParseJWTToken(token, before, 0); err != nil {
+		t.Fatalf("before retirement: %v", err)
+	}
+
+	after := load(t, keys.Source{Secret: testSecret, Dir: d.path, Active: "rsa", Retired: " old, ext "})
+	if _, err = middleware.ParseJWTToken(token, after, 0); !errors.Is(err, middleware.ErrBadToken) {
+		t.Errorf("after retirement: err = %v", err)
+	}
+	for _, key := range after.Keys() {
+		if key.ID == "old" || key.ID == "ext" {
+			t.Errorf("retired key %s is loaded", key.ID)
+		}
+	}
+
+	// старые токены без kid проверяются ключом secret, пока его не вывели
+	legacy := signWith(t, jwt.SigningMethodHS256, "", []byte(testSecret))
+	noSecret := load(t, keys.Source{Secret: testSecret, Dir: d.path, Active: "rsa", Retired: keys.SecretKeyID})
+	if _, err = middleware.ParseJWTToken(legacy, noSecret, 0); !errors.Is(err, middleware.ErrBadToken) {
+		t.Errorf("legacy token after secret retirement: err = %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	d := newKeyDir(t)
+	m := load(t, keys.Source{Secret: testSecret, Dir: d.path, Active: "rsa"})
+	set := m.JWKS()
+
+	got := map[string]keys.JWK{}
+	for _, jwk := range set.Keys {
+		got[jwk.Kid] = jwk
+	}
+	if len(got) != 3 {
+		t.Fatalf("kids = %v", got)
+	}
+	if _, ok := got[keys.SecretKeyID]; ok {
+		t.Error("HS256 secret published")
+	}
+	if _, ok := got["old"]; ok {
+		t.Error("HS256 key from dir published")
+	}
+
+	for kid, want := range map[string]*rsa.PublicKey{"rsa": &d.rsa.PublicKey, "ext": d.extPub} {
+		jwk := got[kid]
+		if jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Use != "sig" {
+			t.Errorf("%s = %+v", kid, jwk)
+		}
+		if n := decodeInt(t, jwk.N); n.Cmp(want.N) != 0 {
+			t.Errorf("%s: modulus mismatch", kid)
+		}
+		if e := decodeInt(t, jwk.E); e.Int64() != int64(want.E) {
+			t.Errorf("%s: exponent = %v", kid, e)
+		}
+	}
+	ed := got["ed"]
+	x, err := base64.RawURLEncoding.DecodeString(ed.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || !d.ed.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		t.Errorf("ed = %+v", ed)
+	}
+
+	// ни секретов, ни приватных частей в ответе
+	body, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{`"d"`, `"p"`, `"k"`, testSecret, "fedcba98"} {
+		if strings.Contains(string(body), leak) {
+			t.Errorf("JWKS contains %s: %s", leak, body)
+		}
+	}
+}
+
+func decodeInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+func TestLoadErrors(t *testing.T) {
+	d := newKeyDir(t)
+	dup := t.TempDir()
+	writeFile(t, dup, keys.SecretKeyID+".secret", []byte(testSecret))
+	badName := t.TempDir()
+	writeFile(t, badName, "bad kid.secret", []byte(testSecret))
+	badExt := t.TempDir()
+	writeFile(t, badExt, "key.txt", []byte(testSecret))
+	weak := t.TempDir()
+	writeFile(t, weak, "weak.secret", []byte("short"))
+
+	tests := []struct {
+		name string
+		src  keys.Source
+	}{
+		{"short secret", keys.Source{Secret: "short"}},
+		{"no active with several keys", keys.Source{Secret: testSecret, Dir: d.path}},
+		{"active retired", keys.Source{Secret: testSecret, Dir: d.path, Active: "rsa", Retired: "rsa"}},
+		{"active not loaded", keys.Source{Secret: testSecret, Active: "rsa"}},
+		{"active is public only", keys.Source{Dir: d.path, Active: "ext"}},
+		{"duplicate kid", keys.Source{Secret: testSecret, Dir: dup}},
+		{"bad kid", keys.Source{Dir: badName}},
+		{"unknown extension", keys.Source{Dir: badExt}},
+		{"weak secret in dir", keys.Source{Dir: weak}},
+		{"missing dir", keys.Source{Secret: testSecret, Dir: filepath.Join(d.path, "nope")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keys.Load(tt.src); err == nil {
+				t.Error("loaded")
+			}
+		})
+	}
+
+	// единственный ключ становится активным сам
+	m := load(t, keys.Source{Secret: testSecret})
+	if m.Active().ID != keys.SecretKeyID {
+		t.Errorf("active = %s", m.Active().ID)
+	}
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync/atomic"
+)
+
+type ctxKey struct{}
+
+// scoped - логгер запроса. Поля добавляются на месте, поэтому их видят и внешние
+// middleware: user_id, который выставляет Auth, попадает и в строку AccessLog.
+type scoped struct {
+	logger atomic.Pointer[zap.SugaredLogger]
+}
+
+// NewContext кладет в контекст логгер запроса.
+func NewContext(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	s := &scoped{}
+	s.logger.Store(logger)
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// FromContext возвращает логгер запроса, а вне запроса - глобальный zap.S().
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if s, ok := ctx.Value(ctxKey{}).(*scoped); ok {
+		return s.logger.Load()
+	}
+	return zap.S()
+}
+
+// Annotate добавляет поля логгеру запроса; вне запроса ничего не делает.
+func Annotate(ctx context.Context, args ...interface{}) {
+	if s, ok := ctx.Value(ctxKey{}).(*scoped); ok {
+		s.logger.Store(s.logger.Load().With(args...))
+	}
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"github.com/gorilla/mux"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const unmatchedRoute = "unmatched"
+
+// Middleware считает запросы по шаблону маршрута mux ("/api/post/{post_id}"), а не по пути,
+// иначе каждый пост порождал бы свой временной ряд. Шаблон определяется через router.Match,
+// поэтому middleware можно ставить снаружи Auth и учитывать его редиректы.
+func Middleware(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if tpl, err := match.Route.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		httpInFlight.Inc()
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			httpInFlight.Dec()
+			status := rec.status
+			if err := recover(); err != nil {
+				// ответ 500 напишет middleware.Panic снаружи
+				observe(route, r.Method, http.StatusInternalServerError, start)
+				panic(err)
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
+			observe(route, r.Method, status, start)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func observe(route, method string, status int, start time.Time) {
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status/100)+"xx").Inc()
+	httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+}
+
+// statusRecorder запоминает код ответа, сохраняя Flusher и Hijacker исходного writer:
+// без них перестанут работать SSE и WebSocket.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap нужен http.ResponseController, например для снятия дедлайна записи в SSE.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"time"
+)
+
+func since(repo, method string, start time.Time) {
+	repoDuration.WithLabelValues(repo, method).Observe(time.Since(start).Seconds())
+}
+
+// ItemsRepo замеряет время каждого вызова репозитория постов и считает созданные
+// посты, комментарии и голоса - только успешные операции.
+type ItemsRepo struct {
+	Repo posts.ItemsRepo
+}
+
+func NewItemsRepo(repo posts.ItemsRepo) *ItemsRepo {
+	return &ItemsRepo{Repo: repo}
+}
+
+func (r *ItemsRepo) GetAll(ctx context.Context) []*posts.Post {
+	defer since("items", "GetAll", time.Now())
+	return r.Repo.GetAll(ctx)
+}
+
+func (r *ItemsRepo) AddPost(ctx context.Context, post *posts.PostToFront) {
+	defer since("items", "AddPost", time.Now())
+	r.Repo.AddPost(ctx, post)
+	if post.ID != "" {
+		PostsCreated.Inc()
+	}
+}
+
+func (r *ItemsRepo) AddComment(ctx context.Context, postID string, comment posts.Comment) *posts.Post {
+	defer since("items", "AddComment", time.Now())
+	post := r.Repo.AddComment(ctx, postID, comment)
+	if post != nil {
+		CommentsCreated.Inc()
+	}
+	return post
+}
+
+func (r *ItemsRepo) DeleteComment(ctx context.Context, postID string, commentID string) *posts.Post {
+	defer since("items", "DeleteComment", time.Now())
+	return r.Repo.DeleteComment(ctx, postID, commentID)
+}
+
+func (r *ItemsRepo) DeletePost(ctx context.Context, id string) {
+	defer since("items", "DeletePost", time.Now())
+	r.Repo.DeletePost(ctx, id)
+}
+
+func (r *ItemsRepo) AddVote(ctx context.Context, postID string, userID string, vote posts.Vote) *posts.Post {
+	defer since("items", "AddVote", time.Now())
+	post := r.Repo.AddVote(ctx, postID, userID, vote)
+	if post != nil && post.ID != "" {
+		switch {
+		case vote.Vote > 0:
+			Votes.WithLabelValues("up").Inc()
+		case vote.Vote < 0:
+			Votes.WithLabelValues("down").Inc()
+		}
+	}
+	return post
+}
+
+func (r *ItemsRepo) DeleteVote(ctx context.Context, postID string, userID string) *posts.Post {
+	defer since("items", "DeleteVote", time.Now())
+	post := r.Repo.DeleteVote(ctx, postID, userID)
+	if post != nil && post.ID != "" {
+		Votes.WithLabelValues("removed").Inc()
+	}
+	return post
+}
+
+func (r *ItemsRepo) FindPost(ctx context.Context, postID string) (*posts.Post, bool) {
+	defer since("items", "FindPost", time.Now())
+	return r.Repo.FindPost(ctx, postID)
+}
+
+func (r *ItemsRepo) AddDraft(ctx context.Context, post *posts.PostToFront, publishAt *time.Time) {
+	defer since("items", "AddDraft", time.Now())
+	r.Repo.AddDraft(ctx, post, publishAt)
+}
+
+func (r *ItemsRepo) GetDrafts(ctx context.Context, authorID string) []*posts.Post {
+	defer since("items", "GetDrafts", time.Now())
+	return r.Repo.GetDrafts(ctx, authorID)
+}
+
+func (r *ItemsRepo) UpdateDraft(ctx context.Context, post *posts.Post) bool {
+	defer since("items", "UpdateDraft", time.Now())
+	return r.Repo.UpdateDraft(ctx, post)
+}
+
+func (r *ItemsRepo) SetDraftSchedule(ctx context.Context, postID string, publishAt *time.Time) (*posts.Post, bool) {
+	defer since("items", "SetDraftSchedule", time.Now())
+	return r.Repo.SetDraftSchedule(ctx, postID, publishAt)
+}
+
+func (r *ItemsRepo) PublishDraft(ctx context.Context, postID string, now time.Time) (*posts.Post, bool) {
+	defer since("items", "PublishDraft", time.Now())
+	post, ok := r.Repo.PublishDraft(ctx, postID, now)
+	if ok {
+		PostsCreated.Inc()
+	}
+	return post, ok
+}
+
+func (r *ItemsRepo) PublishDue(ctx context.Context, now time.Time) []*posts.Post {
+	defer since("items", "PublishDue", time.Now())
+	published := r.Repo.PublishDue(ctx, now)
+	PostsCreated.Add(float64(len(published)))
+	return published
+}
+
+func (r *ItemsRepo) ArchiveOlderThan(ctx context.Context, category string, before time.Time) (int, error) {
+	defer since("items", "ArchiveOlderThan", time.Now())
+	return r.Repo.ArchiveOlderThan(ctx, category, before)
+}
+
+func (r *ItemsRepo) ReplaceAuthor(ctx context.Context, authorID string, replacement posts.Author) error {
+	defer since("items", "ReplaceAuthor", time.Now())
+	return r.Repo.ReplaceAuthor(ctx, authorID, replacement)
+}
+
+func (r *ItemsRepo) DeleteByAuthor(ctx context.Context, authorID string) error {
+	defer since("items", "DeleteByAuthor", time.Now())
+	return r.Repo.DeleteByAuthor(ctx, authorID)
+}
+
+func (r *ItemsRepo) AllPosts(ctx context.Context) []*posts.Post {
+	defer since("items", "AllPosts", time.Now())
+	return r.Repo.AllPosts(ctx)
+}
+
+func (r *ItemsRepo) SetRemoved(ctx context.Context, postID string, removed bool) (*posts.Post, bool) {
+	defer since("items", "SetRemoved", time.Now())
+	return r.Repo.SetRemoved(ctx, postID, removed)
+}
+
+func (r *ItemsRepo) RecountVotes(ctx context.Context, postID string) (*posts.Post, bool) {
+	defer since("items", "RecountVotes", time.Now())
+	return r.Repo.RecountVotes(ctx, postID)
+}
+
+func (r *ItemsRepo) ImportPost(ctx context.Context, post *posts.Post) error {
+	defer since("items", "ImportPost", time.Now())
+	return r.Repo.ImportPost(ctx, post)
+}
+
+// UserRepo замеряет вызовы, участвующие в каждом запросе, и считает входы и регистрации;
+// остальные методы проходят насквозь.
+type UserRepo struct {
+	user.UserRepo
+}
+
+func NewUserRepo(repo user.UserRepo) *UserRepo {
+	return &UserRepo{UserRepo: repo}
+}
+
+func (r *UserRepo) Authorize(ctx context.Context, login, pass string) (user.User, error) {
+	defer since("users", "Authorize", time.Now())
+	u, err := r.UserRepo.Authorize(ctx, login, pass)
+	if err != nil {
+		LoginFailures.Inc()
+	} else {
+		Logins.Inc()
+	}
+	return u, err
+}
+
+func (r *UserRepo) SignUp(ctx context.Context, login, pass string) (user.User, error) {
+	defer since("users", "SignUp", time.Now())
+	u, err := r.UserRepo.SignUp(ctx, login, pass)
+	if err == nil {
+		Registrations.Inc()
+	}
+	return u, err
+}
+
+func (r *UserRepo) GetUser(ctx context.Context, login string) (user.User, error) {
+	defer since("users", "GetUser", time.Now())
+	return r.UserRepo.GetUser(ctx, login)
+}
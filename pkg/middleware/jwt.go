@@ -1,54 +1,94 @@
 package middleware
 
 import (
+	"cmd/redditclone/pkg/keys"
 	"cmd/redditclone/pkg/user"
-	"encoding/json"
-	"github.com/dgrijalva/jwt-go"
-	"io"
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
-var ExampleTokenSecret = []byte("супер секретный ключ")
+var (
+	ErrNoToken      = errors.New("no token in request")
+	ErrTokenExpired = errors.New("token expired")
+	ErrBadToken     = errors.New("invalid token")
+)
+
+type TokenUser struct {
+	Username string `json:"username"`
+	ID       string `json:"id"`
+}
 
-func GenerateJWTToken(w http.ResponseWriter, user user.User) ([]byte, string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": map[string]interface{}{
-			"username": user.Login,
-			"id":       strconv.Itoa(user.ID),
+// Claims - полезная нагрузка токена; поле user читает фронтенд.
+type Claims struct {
+	User TokenUser `json:"user"`
+	jwt.RegisteredClaims
+}
+
+// GenerateJWTToken выпускает access-токен на ttl, подписанный активным ключом, и возвращает
+// его вместе со временем истечения.
+func GenerateJWTToken(user user.User, keys *keys.Manager, ttl time.Duration) (string, time.Time, error) {
+	// jti делает токены уникальными: два входа в одну секунду иначе дали бы один и тот же
+	// токен, а он - первичный ключ сессии
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	tokenString, err := keys.Sign(Claims{
+		User: TokenUser{Username: user.Login, ID: strconv.Itoa(user.ID)},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
-		"iat": time.Now().Unix(),
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
 	})
-	tokenString, err := token.SignedString(ExampleTokenSecret)
 	if err != nil {
-		JSONError(w, http.StatusInternalServerError, err.Error())
-		return nil, "", err
+		return "", time.Time{}, err
 	}
+	return tokenString, expiresAt, nil
+}
 
-	resp, err := json.Marshal(map[string]interface{}{
-		"token": tokenString,
-	})
-	if err != nil {
-		JSONError(w, http.StatusInternalServerError, err.Error())
-		return nil, "", err
+// ParseJWTToken проверяет подпись ключом из kid, алгоритм (только алгоритмы загруженных
+// ключей - иначе прошел бы токен с alg=none) и сроки exp/iat/nbf с допуском leeway на расхождение часов.
+func ParseJWTToken(tokenString string, keys *keys.Manager, leeway time.Duration) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc,
+		jwt.WithValidMethods(keys.Algorithms()),
+		jwt.WithLeeway(leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, ErrTokenExpired
+	case err != nil:
+		return nil, ErrBadToken
+	case claims.User.ID == "":
+		return nil, ErrBadToken
 	}
-	return resp, tokenString, nil
+	return claims, nil
 }
 
-func JSONError(w io.Writer, status int, msg string) {
-	resp, err := json.Marshal(map[string]interface{}{
-		"status": status,
-		"error":  msg,
-	})
-	if err != nil {
-		log.Println(err)
-		return
+// tokenFromRequest берет токен из заголовка Authorization: Bearer, который шлет фронтенд,
+// а если его нет - из cookie token (ее ставит логин, и только она есть у WebSocket и ссылок на ленты).
+func tokenFromRequest(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			return "", ErrBadToken
+		}
+		return strings.TrimSpace(token), nil
 	}
-	_, err = w.Write(resp)
-	if err != nil {
-		log.Println("JSONError:", err)
+	if cookie, err := r.Cookie("token"); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
 	}
+	return "", ErrNoToken
 }
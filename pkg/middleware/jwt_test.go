@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"cmd/redditclone/pkg/keys"
+	"cmd/redditclone/pkg/user"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func testKeys(t *testing.T, secret string) *keys.Manager {
+	t.Helper()
+	m, err := keys.Load(keys.Source{Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestGenerateAndParse(t *testing.T) {
+	m := testKeys(t, testSecret)
+	token, expiresAt, err := GenerateJWTToken(user.User{ID: 7, Login: "alice"}, m, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d <= 0 || d > time.Minute {
+		t.Errorf("expires in %v", d)
+	}
+	claims, err := ParseJWTToken(token, m, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.User.ID != "7" || claims.User.Username != "alice" || claims.ID == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// jti делает токены одного пользователя разными даже в одну секунду
+	again, _, err := GenerateJWTToken(user.User{ID: 7, Login: "alice"}, m, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == token {
+		t.Error("two tokens are equal")
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	m := testKeys(t, testSecret)
+	now := time.Now()
+	valid := func() Claims {
+		return Claims{
+			User: TokenUser{Username: "alice", ID: "7"},
+			RegisteredClaims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+		}
+	}
+	sign := func(t *testing.T, claims Claims) string {
+		t.Helper()
+		token, err := m.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSecret, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("ffffffffffffffffffffffffffffffff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, valid()).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noExp := valid()
+	noExp.ExpiresAt = nil
+	noUser := valid()
+	noUser.User = TokenUser{}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"alg none", none, ErrBadToken},
+		{"other secret", otherSecret, ErrBadToken},
+		{"not allowed alg", hs512, ErrBadToken},
+		{"garbage", "a.b.c", ErrBadToken},
+		{"no exp", sign(t, noExp), ErrBadToken},
+		{"no user", sign(t, noUser), ErrBadToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseJWTToken(tt.token, m, 0); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLeeway(t *testing.T) {
+	m := testKeys(t, testSecret)
+	const leeway = 30 * time.Second
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		edit func(c *jwt.RegisteredClaims)
+		want error
+	}{
+		{"exp within leeway", func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) }, nil},
+		{"exp past leeway", func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }, ErrTokenExpired},
+		{"nbf within leeway", func(c *jwt.RegisteredClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second)) }, nil},
+		{"nbf past leeway", func(c *jwt.RegisteredClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }, ErrBadToken},
+		{"iat within leeway", func(c *jwt.RegisteredClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(10 * time.Second)) }, nil},
+		{"iat past leeway", func(c *jwt.RegisteredClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) }, ErrBadToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := Claims{
+				User: TokenUser{Username: "alice", ID: "7"},
+				RegisteredClaims: jwt.RegisteredClaims{
+					IssuedAt:  jwt.NewNumericDate(now.Add(-time.Hour)),
+					ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				},
+			}
+			tt.edit(&claims.RegisteredClaims)
+			token, err := m.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = ParseJWTToken(token, m, leeway); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			// без допуска проходит только токен, который и так в сроке
+			if tt.want == nil {
+				if _, err = ParseJWTToken(token, m, 0); err == nil {
+					t.Error("accepted without leeway")
+				}
+			}
+		})
+	}
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   string
+		err    error
+	}{
+		{"bearer", "Bearer abc", "", "abc", nil},
+		{"bearer case", "bearer  abc ", "", "abc", nil},
+		{"header wins", "Bearer abc", "def", "abc", nil},
+		{"cookie", "", "def", "def", nil},
+		{"other scheme", "Basic abc", "", "", ErrBadToken},
+		{"empty bearer", "Bearer ", "", "", ErrBadToken},
+		{"none", "", "", "", ErrNoToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+			}
+			got, err := tokenFromRequest(req)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("got %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
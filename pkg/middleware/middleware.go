@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"cmd/redditclone/pkg/apierr"
+	"cmd/redditclone/pkg/keys"
+	"cmd/redditclone/pkg/logging"
 	"cmd/redditclone/pkg/session"
-	"go.uber.org/zap"
-	"log"
+	"errors"
 	"net/http"
+	"runtime/debug"
 	"strings"
 	"time"
 )
@@ -16,51 +19,114 @@ var (
 		"/manifest.json": {},
 		"/api/login":     {},
 		"/api/register":  {},
+		// access-токен к этому моменту уже мог истечь
+		"/api/token/refresh": {},
+		"/healthz":           {},
+		"/readyz":            {},
+		"/metrics":           {},
+		// публичные ключи нужны сторонним сервисам без токена
+		"/.well-known/jwks.json": {},
 	}
 	noSessUrls = map[string]struct{}{
 		"/": {},
 	}
 )
 
-func Auth(sm *session.SessionsManager, next http.Handler) http.Handler {
+// Auth пускает к закрытым адресам только с действующим JWT, сессия которого не отозвана.
+// API получает 401 в JSON, остальные адреса - редирект на главную.
+func Auth(sm *session.SessionsManager, keys *keys.Manager, leeway time.Duration, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
 		if strings.HasPrefix(r.URL.Path, "/static/") {
-			log.Println("Не нужна авторизация для static:", r.URL.Path)
+			logger.Debugf("Не нужна авторизация для static: %s", r.URL.Path)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/feeds/") {
 			next.ServeHTTP(w, r)
 			return
 		}
 		if r.Method == http.MethodGet &&
 			(strings.HasPrefix(r.URL.Path, "/api/posts/") || strings.HasPrefix(r.URL.Path, "/api/post/") ||
-				strings.HasPrefix(r.URL.Path, "/api/user/")) && !strings.Contains(r.URL.Path, "vote") {
-			log.Println("Не нужна авторизация для получения информации о постах", r.URL.Path)
+				strings.HasPrefix(r.URL.Path, "/api/user/") || strings.HasPrefix(r.URL.Path, "/api/domain/")) && !strings.Contains(r.URL.Path, "vote") {
+			logger.Debugf("Не нужна авторизация для получения информации о постах: %s", r.URL.Path)
 			next.ServeHTTP(w, r)
 			return
 		}
 		if _, ok := noAuthUrls[r.URL.Path]; ok {
-			log.Println("Не нужна авторизация", r.URL.Path)
+			logger.Debugf("Не нужна авторизация: %s", r.URL.Path)
 			next.ServeHTTP(w, r)
 			return
 		}
-		sess, err := sm.Check(r)
+		sess, err := authenticate(r, sm, keys, leeway)
 
 		_, canbeWithouthSess := noSessUrls[r.URL.Path]
 		if err != nil && !canbeWithouthSess {
-			log.Println("no auth", r.URL.Path)
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				writeAuthError(w, r, err)
+				return
+			}
+			logger.Infof("Нет сессии, редирект на главную: %s", r.URL.Path)
 			http.Redirect(w, r, "/", http.StatusFound)
 			return
 		}
 
+		if sess != nil {
+			logging.Annotate(r.Context(), "user_id", sess.UserID)
+		}
 		ctx := session.ContextWithSession(r.Context(), sess)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func AccessLog(logger *zap.SugaredLogger, next http.Handler) http.Handler {
+func authenticate(r *http.Request, sm *session.SessionsManager, keys *keys.Manager, leeway time.Duration) (*session.Session, error) {
+	token, err := tokenFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := ParseJWTToken(token, keys, leeway)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := sm.Check(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	if sess.UserID != claims.User.ID {
+		return nil, ErrBadToken
+	}
+	return sess, nil
+}
+
+func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *apierr.Error
+	switch {
+	case errors.Is(err, ErrNoToken):
+		apiErr = apierr.Unauthorized("authorization required")
+	case errors.Is(err, ErrTokenExpired):
+		apiErr = apierr.New(http.StatusUnauthorized, apierr.CodeTokenExpired, "token expired")
+	case errors.Is(err, ErrBadToken):
+		apiErr = apierr.Unauthorized("invalid token")
+	case errors.Is(err, session.ErrNoAuth):
+		apiErr = apierr.Unauthorized("session is revoked")
+	default:
+		apierr.Write(w, r, apierr.Internal(err))
+		return
+	}
+	if errors.Is(err, ErrNoToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="redditclone"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="redditclone", error="invalid_token"`)
+	}
+	apierr.Write(w, r, apiErr)
+}
+
+// AccessLog и Panic пишут в логгер запроса, поэтому ставятся внутри RequestID.
+func AccessLog(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Println("access log middleware")
 		start := time.Now()
 		next.ServeHTTP(w, r)
-		logger.Infow("New request",
+		logging.FromContext(r.Context()).Infow("New request",
 			"method", r.Method,
 			"remote_addr", r.RemoteAddr,
 			"url", r.URL.Path,
@@ -69,13 +135,12 @@ func AccessLog(logger *zap.SugaredLogger, next http.Handler) http.Handler {
 	})
 }
 
-func Panic(logger *zap.SugaredLogger, next http.Handler) http.Handler {
+func Panic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Println("panicMiddleware", r.URL.Path)
 		defer func() {
 			if err := recover(); err != nil {
-				logger.Error("recovered", err)
-				http.Error(w, "Internal server error", 500)
+				logging.FromContext(r.Context()).Errorw("Паника при обработке запроса", "panic", err, "stack", string(debug.Stack()))
+				apierr.Write(w, r, apierr.New(http.StatusInternalServerError, apierr.CodeInternal, "internal server error"))
 			}
 		}()
 		next.ServeHTTP(w, r)
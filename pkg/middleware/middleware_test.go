@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"cmd/redditclone/pkg/apierr"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func TestPanicWritesInternalError(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	h := RequestID(zap.NewNop().Sugar(), r, Panic(r))
+
+	req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var body apierr.Error
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != apierr.CodeInternal || body.RequestID != "req-42" {
+		t.Errorf("body = %+v", body)
+	}
+	// текст паники клиенту не отдается
+	if body.Message != "internal server error" {
+		t.Errorf("message = %q", body.Message)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	r := mux.NewRouter()
+	var fromCtx string
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fromCtx = RequestIDFromContext(r.Context())
+	})
+	h := RequestID(zap.NewNop().Sugar(), r, r)
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"from proxy", "abc-123_x.y:z", true},
+		{"missing", "", false},
+		{"bad chars", "id with spaces", false},
+		{"too long", string(make([]byte, maxRequestIDLen+1)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(RequestIDHeader)
+			if got == "" || got != fromCtx {
+				t.Fatalf("header %q, context %q", got, fromCtx)
+			}
+			if tt.keep != (got == tt.header) {
+				t.Errorf("request id = %q, incoming %q", got, tt.header)
+			}
+		})
+	}
+}
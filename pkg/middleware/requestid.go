@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"cmd/redditclone/pkg/logging"
+	"cmd/redditclone/pkg/tracing"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen ограничивает чужой ID: он попадает в каждую строку лога
+const maxRequestIDLen = 64
+
+type requestIDKey struct{}
+
+// RequestID берет X-Request-ID от прокси или клиента, а если его нет или он подозрительный -
+// генерирует свой. ID возвращается в заголовке ответа, а в контекст кладется логгер
+// с request_id, маршрутом mux и trace_id.
+func RequestID(logger *zap.SugaredLogger, router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		route := "unmatched"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if tpl, err := match.Route.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		reqLogger := logger.With(append([]interface{}{"request_id", id, "route", route}, tracing.Fields(r.Context())...)...)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = logging.NewContext(ctx, reqLogger)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
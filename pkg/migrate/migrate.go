@@ -0,0 +1,314 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+const (
+	lockName    = "reddit_clone_migrations"
+	lockTimeout = 30 * time.Second
+)
+
+var ErrLocked = errors.New("another instance is running migrations")
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Record struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator применяет встроенные в бинарник SQL-миграции к MySQL. Применение защищено
+// GET_LOCK, поэтому два инстанса, стартующие одновременно, не мигрируют базу параллельно.
+type Migrator struct {
+	DB         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, migrations: migrations}, nil
+}
+
+// load читает пары NNNN_name.up.sql / NNNN_name.down.sql.
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionPart, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionPart)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration file %s: expected NNNN_name.%s.sql", name, direction)
+		}
+		body, err := fs.ReadFile(fsys, path.Join("sql", name))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up применяет все еще не примененные миграции и возвращает их список.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		records, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := records[mig.Version]; ok {
+				continue
+			}
+			if err = execScript(ctx, conn, mig.Up); err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			_, err = conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+				mig.Version, mig.Name, mig.Checksum, time.Now().UTC())
+			if err != nil {
+				return err
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает steps последних примененных миграций.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		records, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := records[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down file", mig.Version, mig.Name)
+			}
+			if err = execScript(ctx, conn, mig.Down); err != nil {
+				return fmt.Errorf("revert %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			if _, err = conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+				return err
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	records, err := appliedRecords(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		rec, ok := records[mig.Version]
+		statuses = append(statuses, Status{Migration: mig, Applied: ok, AppliedAt: rec.AppliedAt})
+	}
+	return statuses, nil
+}
+
+// verify сверяет контрольные суммы примененных миграций с файлами в бинарнике:
+// изменение уже примененной миграции - ошибка, ее нужно оформлять новой миграцией.
+func (m *Migrator) verify(ctx context.Context, conn *sql.Conn) (map[int]Record, error) {
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	records, err := appliedRecords(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	known := map[int]Migration{}
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	for version, rec := range records {
+		mig, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("database has migration %04d_%s unknown to this binary", version, rec.Name)
+		}
+		if mig.Checksum != rec.Checksum {
+			return nil, fmt.Errorf("checksum mismatch for migration %04d_%s: applied %s, file %s",
+				version, mig.Name, rec.Checksum, mig.Checksum)
+		}
+	}
+	return records, nil
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	// GET_LOCK привязан к соединению, поэтому вся работа идет через одно *sql.Conn
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var got sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())).Scan(&got)
+	if err != nil {
+		return err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return ErrLocked
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+
+	return fn(conn)
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    BIGINT       NOT NULL,
+    name       VARCHAR(255) NOT NULL,
+    checksum   CHAR(64)     NOT NULL,
+    applied_at DATETIME     NOT NULL,
+    PRIMARY KEY (version)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4`)
+	return err
+}
+
+func appliedRecords(ctx context.Context, conn *sql.Conn) (map[int]Record, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := map[int]Record{}
+	for rows.Next() {
+		var (
+			rec       Record
+			appliedAt interface{}
+		)
+		if err = rows.Scan(&rec.Version, &rec.Name, &rec.Checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		// в зависимости от parseTime в DSN драйвер отдает time.Time или []byte
+		switch v := appliedAt.(type) {
+		case time.Time:
+			rec.AppliedAt = v
+		case []byte:
+			rec.AppliedAt, _ = time.Parse("2006-01-02 15:04:05", string(v))
+		}
+		records[rec.Version] = rec
+	}
+	return records, rows.Err()
+}
+
+// execScript выполняет файл миграции по одному выражению: драйвер MySQL по умолчанию
+// не принимает несколько выражений в одном Exec.
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitStatements(script string) []string {
+	var (
+		stmts   []string
+		current strings.Builder
+	)
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
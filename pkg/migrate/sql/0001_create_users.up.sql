@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS users (
+    id       INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    login    VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uniq_users_login (login)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
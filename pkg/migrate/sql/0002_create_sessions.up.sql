@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    token      VARCHAR(512) NOT NULL,
+    login      VARCHAR(255) NOT NULL,
+    user_id    VARCHAR(64)  NOT NULL,
+    is_active  TINYINT(1)   NOT NULL DEFAULT 0,
+    created_at TIMESTAMP    NULL,
+    expires_at TIMESTAMP    NULL,
+    PRIMARY KEY (token),
+    KEY idx_sessions_user_id (user_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN suspended TINYINT(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS account_deletions (
+    user_id     VARCHAR(64)  NOT NULL,
+    login       VARCHAR(255) NOT NULL,
+    mode        VARCHAR(16)  NOT NULL,
+    step        VARCHAR(16)  NOT NULL,
+    started_at  DATETIME     NOT NULL,
+    finished_at DATETIME     NULL,
+    PRIMARY KEY (user_id),
+    KEY idx_account_deletions_step (step)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
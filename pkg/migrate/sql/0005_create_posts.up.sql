@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS posts (
+    id                VARCHAR(24)   NOT NULL,
+    author_id         VARCHAR(64)   NOT NULL,
+    author_username   VARCHAR(255)  NOT NULL,
+    category          VARCHAR(32)   NOT NULL,
+    type              VARCHAR(16)   NOT NULL,
+    title             VARCHAR(512)  NOT NULL,
+    text              TEXT          NOT NULL,
+    url               VARCHAR(2048) NOT NULL DEFAULT '',
+    normalized_url    VARCHAR(2048) NOT NULL DEFAULT '',
+    domain            VARCHAR(255)  NOT NULL DEFAULT '',
+    created           DATETIME(6)   NOT NULL,
+    score             INT           NOT NULL DEFAULT 0,
+    score_count       INT           NOT NULL DEFAULT 0,
+    upvote_count      INT           NOT NULL DEFAULT 0,
+    upvote_percentage INT           NOT NULL DEFAULT 0,
+    views             INT           NOT NULL DEFAULT 0,
+    status            VARCHAR(16)   NOT NULL DEFAULT '',
+    publish_at        DATETIME(6)   NULL,
+    archived          BOOLEAN       NOT NULL DEFAULT FALSE,
+    removed           BOOLEAN       NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    KEY idx_posts_category_created (category, created),
+    KEY idx_posts_author (author_id),
+    KEY idx_posts_status_publish_at (status, publish_at),
+    KEY idx_posts_domain (domain)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS comments (
+    id              VARCHAR(24)  NOT NULL,
+    post_id         VARCHAR(24)  NOT NULL,
+    author_id       VARCHAR(64)  NOT NULL,
+    author_username VARCHAR(255) NOT NULL,
+    body            TEXT         NOT NULL,
+    created         DATETIME(6)  NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_comments_post (post_id),
+    KEY idx_comments_author (author_id),
+    CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS votes (
+    post_id VARCHAR(24) NOT NULL,
+    user_id VARCHAR(64) NOT NULL,
+    vote    TINYINT     NOT NULL,
+    PRIMARY KEY (post_id, user_id),
+    KEY idx_votes_user (user_id),
+    CONSTRAINT fk_votes_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,3 @@
+ALTER TABLE sessions DROP KEY idx_sessions_family_id;
+ALTER TABLE sessions DROP COLUMN family_id;
+DROP TABLE IF EXISTS refresh_tokens;
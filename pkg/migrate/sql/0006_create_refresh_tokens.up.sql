@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash CHAR(64)     NOT NULL,
+    family_id  VARCHAR(64)  NOT NULL,
+    user_id    VARCHAR(64)  NOT NULL,
+    login      VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP    NULL,
+    expires_at TIMESTAMP    NULL,
+    used_at    TIMESTAMP    NULL,
+    revoked_at TIMESTAMP    NULL,
+    PRIMARY KEY (token_hash),
+    KEY idx_refresh_tokens_family_id (family_id),
+    KEY idx_refresh_tokens_user_id (user_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+ALTER TABLE sessions ADD COLUMN family_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD KEY idx_sessions_family_id (family_id);
@@ -0,0 +1,3 @@
+DELETE FROM sessions WHERE CHAR_LENGTH(token) > 512;
+ALTER TABLE sessions DROP PRIMARY KEY, MODIFY token VARCHAR(512) NOT NULL, ADD PRIMARY KEY (token);
+ALTER TABLE sessions DROP COLUMN token_hash;
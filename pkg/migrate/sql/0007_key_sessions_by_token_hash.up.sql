@@ -0,0 +1,3 @@
+ALTER TABLE sessions ADD COLUMN token_hash CHAR(64) NOT NULL DEFAULT '';
+UPDATE sessions SET token_hash = SHA2(token, 256);
+ALTER TABLE sessions DROP PRIMARY KEY, MODIFY token TEXT NOT NULL, ADD PRIMARY KEY (token_hash);
@@ -0,0 +1,91 @@
+package posts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"time"
+)
+
+var ErrArchived = errors.New("post is archived and can no longer be voted on or commented")
+
+// ArchivePolicy задает возраст, после которого пост становится только для чтения.
+// Нулевая длительность отключает архивирование для категории.
+type ArchivePolicy struct {
+	Default     time.Duration
+	PerCategory map[string]time.Duration
+}
+
+func (ap ArchivePolicy) MaxAge(category string) time.Duration {
+	if age, ok := ap.PerCategory[category]; ok {
+		return age
+	}
+	return ap.Default
+}
+
+// IsArchived учитывает и флаг из базы, и возраст поста: фоновая задача могла еще не дойти до него.
+func (ap ArchivePolicy) IsArchived(post *Post, now time.Time) bool {
+	if post.Archived {
+		return true
+	}
+	age := ap.MaxAge(post.Category)
+	return age > 0 && post.IsPublished() && post.Created.Before(now.Add(-age))
+}
+
+// ToFront собирает пост для клиента с флагом archived по той же политике,
+// по которой openPost отказывает в голосах и комментариях.
+func (ap ArchivePolicy) ToFront(post *Post, now time.Time) *PostToFront {
+	front := ConstructPostToFront(post)
+	front.Archived = ap.IsArchived(post, now)
+	return front
+}
+
+func (i *ItemMemoryRepository) ArchiveOlderThan(ctx context.Context, category string, before time.Time) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	filter := bson.M{
+		"category": category,
+		"created":  bson.M{"$lt": before},
+		"archived": bson.M{"$ne": true},
+	}
+	for k, v := range publishedFilter {
+		filter[k] = v
+	}
+	res, err := i.DB.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"archived": true}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
+// ParseArchivePolicy разбирает строку вида "4320h,news=720h,fashion=0":
+// значение без категории - возраст по умолчанию.
+func ParseArchivePolicy(spec string) (ArchivePolicy, error) {
+	policy := ArchivePolicy{PerCategory: map[string]time.Duration{}}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		category, value, hasCategory := strings.Cut(part, "=")
+		if !hasCategory {
+			category, value = "", part
+		}
+		age, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || age < 0 {
+			return ArchivePolicy{}, fmt.Errorf("invalid archive age %q", part)
+		}
+		if !hasCategory {
+			policy.Default = age
+			continue
+		}
+		category = strings.TrimSpace(category)
+		if !IsCategory(category) {
+			return ArchivePolicy{}, fmt.Errorf("unknown category %q in archive policy", category)
+		}
+		policy.PerCategory[category] = age
+	}
+	return policy, nil
+}
@@ -0,0 +1,35 @@
+package posts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchivePolicyToFront(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	policy, err := ParseArchivePolicy("720h,news=24h,fashion=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		post Post
+		want bool
+	}{
+		{"fresh", Post{Category: "music", Created: now.Add(-time.Hour)}, false},
+		{"older than default", Post{Category: "music", Created: now.Add(-721 * time.Hour)}, true},
+		{"per-category age", Post{Category: "news", Created: now.Add(-25 * time.Hour)}, true},
+		{"archiving disabled", Post{Category: "fashion", Created: now.Add(-10000 * time.Hour)}, false},
+		{"flag set by the job", Post{Category: "music", Created: now, Archived: true}, true},
+		{"draft is never archived", Post{Category: "news", Created: now.Add(-48 * time.Hour), Status: StatusDraft}, false},
+	}
+	for _, tc := range cases {
+		post := tc.post
+		if got := policy.IsArchived(&post, now); got != tc.want {
+			t.Errorf("%s: IsArchived = %v, want %v", tc.name, got, tc.want)
+		}
+		if got := policy.ToFront(&post, now).Archived; got != tc.want {
+			t.Errorf("%s: ToFront().Archived = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
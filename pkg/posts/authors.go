@@ -0,0 +1,56 @@
+package posts
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ReplaceAuthor заменяет автора во всех постах (включая черновики) и комментариях.
+// Повторный вызов безопасен: уже замененные записи под фильтр не попадают.
+func (i *ItemMemoryRepository) ReplaceAuthor(ctx context.Context, authorID string, replacement Author) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, err := i.DB.UpdateMany(ctx, bson.M{"author.id": authorID}, bson.M{"$set": bson.M{"author": replacement}})
+	if err != nil {
+		return err
+	}
+	return i.updateAuthorComments(ctx, authorID, func(commentID string) bson.M {
+		return bson.M{"$set": bson.M{"comments." + commentID + ".author": replacement}}
+	})
+}
+
+// DeleteByAuthor удаляет все посты и комментарии автора.
+func (i *ItemMemoryRepository) DeleteByAuthor(ctx context.Context, authorID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, err := i.DB.DeleteMany(ctx, bson.M{"author.id": authorID})
+	if err != nil {
+		return err
+	}
+	return i.updateAuthorComments(ctx, authorID, func(commentID string) bson.M {
+		return bson.M{"$unset": bson.M{"comments." + commentID: ""}}
+	})
+}
+
+// комментарии хранятся как map по id, поэтому ищем их обходом постов
+func (i *ItemMemoryRepository) updateAuthorComments(ctx context.Context, authorID string, update func(commentID string) bson.M) error {
+	c, err := i.DB.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	var all []*Post
+	if err = c.All(ctx, &all); err != nil {
+		return err
+	}
+	for _, post := range all {
+		for commentID, comment := range post.Comments {
+			if comment.Author.ID != authorID {
+				continue
+			}
+			if _, err = i.DB.UpdateOne(ctx, bson.M{"_id": post.ID}, update(commentID)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package posts
+
+import (
+	"cmd/redditclone/pkg/logging"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+)
+
+// у старых постов статуса нет - они считаются опубликованными
+var (
+	publishedFilter = bson.M{
+		"status":  bson.M{"$nin": []string{StatusDraft, StatusScheduled}},
+		"removed": bson.M{"$ne": true},
+	}
+	unpublishedIn = bson.M{"$in": []string{StatusDraft, StatusScheduled}}
+)
+
+func (p *Post) IsPublished() bool {
+	return p.Status == "" || p.Status == StatusPublished
+}
+
+// IsVisible - пост опубликован и не скрыт администратором.
+func (p *Post) IsVisible() bool {
+	return p.IsPublished() && !p.Removed
+}
+
+func (i *ItemMemoryRepository) AddDraft(ctx context.Context, post *PostToFront, publishAt *time.Time) {
+	ans := createPost(post)
+	ans.Status = StatusDraft
+	if publishAt != nil {
+		ans.Status = StatusScheduled
+		ans.PublishAt = publishAt
+	}
+	i.mu.Lock()
+	postID := primitive.NewObjectID().Hex()
+	ans.ID = postID
+	post.ID = postID
+	post.Status = ans.Status
+	post.PublishAt = ans.PublishAt
+	i.DB.InsertOne(ctx, &ans)
+	i.mu.Unlock()
+}
+
+func (i *ItemMemoryRepository) GetDrafts(ctx context.Context, authorID string) []*Post {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var drafts []*Post
+	c, err := i.DB.Find(ctx, bson.M{"author.id": authorID, "status": unpublishedIn})
+	if err != nil {
+		logging.FromContext(ctx).Error(err)
+		return nil
+	}
+	if err = c.All(ctx, &drafts); err != nil {
+		logging.FromContext(ctx).Error(err)
+		return nil
+	}
+	return drafts
+}
+
+// UpdateDraft меняет содержимое черновика; опубликованные посты не трогает.
+func (i *ItemMemoryRepository) UpdateDraft(ctx context.Context, post *Post) bool {
+	post.NormalizedURL, post.Domain = "", ""
+	if post.URL != "" {
+		post.NormalizedURL, _ = NormalizeURL(post.URL)
+		post.Domain = DomainOf(post.URL)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	res, err := i.DB.UpdateOne(ctx,
+		bson.M{"_id": post.ID, "status": unpublishedIn},
+		bson.M{"$set": bson.M{
+			"category":      post.Category,
+			"title":         post.Title,
+			"type":          post.Type,
+			"text":          post.Text,
+			"url":           post.URL,
+			"normalizedUrl": post.NormalizedURL,
+			"domain":        post.Domain,
+		}})
+	if err != nil {
+		logging.FromContext(ctx).Error(err)
+		return false
+	}
+	return res.MatchedCount == 1
+}
+
+// SetDraftSchedule планирует публикацию черновика, а с nil возвращает его в черновики.
+func (i *ItemMemoryRepository) SetDraftSchedule(ctx context.Context, postID string, publishAt *time.Time) (*Post, bool) {
+	update := bson.M{"$set": bson.M{"status": StatusDraft}, "$unset": bson.M{"publishAt": ""}}
+	if publishAt != nil {
+		update = bson.M{"$set": bson.M{"status": StatusScheduled, "publishAt": publishAt}}
+	}
+	return i.findAndUpdate(ctx, bson.M{"_id": postID, "status": unpublishedIn}, update)
+}
+
+// PublishDraft публикует черновик. Условие на статус в фильтре делает операцию атомарной:
+// если пост уже опубликован другим вызовом, второй вызов ничего не изменит.
+func (i *ItemMemoryRepository) PublishDraft(ctx context.Context, postID string, now time.Time) (*Post, bool) {
+	return i.findAndUpdate(ctx, bson.M{"_id": postID, "status": unpublishedIn}, publishUpdate(now))
+}
+
+func (i *ItemMemoryRepository) PublishDue(ctx context.Context, now time.Time) []*Post {
+	i.mu.RLock()
+	var due []*Post
+	c, err := i.DB.Find(ctx, bson.M{"status": StatusScheduled, "publishAt": bson.M{"$lte": now}})
+	if err == nil {
+		err = c.All(ctx, &due)
+	}
+	i.mu.RUnlock()
+	if err != nil {
+		logging.FromContext(ctx).Error(err)
+		return nil
+	}
+
+	published := make([]*Post, 0, len(due))
+	for _, draft := range due {
+		post, ok := i.findAndUpdate(ctx,
+			bson.M{"_id": draft.ID, "status": StatusScheduled, "publishAt": bson.M{"$lte": now}},
+			publishUpdate(now))
+		if ok {
+			published = append(published, post)
+		}
+	}
+	return published
+}
+
+func publishUpdate(now time.Time) bson.M {
+	return bson.M{
+		"$set":   bson.M{"status": StatusPublished, "created": now},
+		"$unset": bson.M{"publishAt": ""},
+	}
+}
+
+func (i *ItemMemoryRepository) findAndUpdate(ctx context.Context, filter, update bson.M) (*Post, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var post *Post
+	err := i.DB.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&post)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			logging.FromContext(ctx).Error(err)
+		}
+		return nil, false
+	}
+	return post, true
+}
@@ -0,0 +1,85 @@
+package posts
+
+import (
+	"cmd/redditclone/pkg/logging"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AllPosts возвращает все посты, включая черновики и скрытые, - для административных задач.
+func (i *ItemMemoryRepository) AllPosts(ctx context.Context) []*Post {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var all []*Post
+	c, err := i.DB.Find(ctx, bson.M{})
+	if err != nil {
+		logging.FromContext(ctx).Error(err)
+		return nil
+	}
+	if err = c.All(ctx, &all); err != nil {
+		logging.FromContext(ctx).Error(err)
+		return nil
+	}
+	return all
+}
+
+func (i *ItemMemoryRepository) SetRemoved(ctx context.Context, postID string, removed bool) (*Post, bool) {
+	update := bson.M{"$set": bson.M{"removed": true}}
+	if !removed {
+		update = bson.M{"$unset": bson.M{"removed": ""}}
+	}
+	return i.findAndUpdate(ctx, bson.M{"_id": postID}, update)
+}
+
+// RecountVotes пересчитывает счетчики поста по сохраненным голосам.
+func (i *ItemMemoryRepository) RecountVotes(ctx context.Context, postID string) (*Post, bool) {
+	post, ok := i.FindPost(ctx, postID)
+	if !ok {
+		return nil, false
+	}
+	RecalculateVotes(post)
+	return i.findAndUpdate(ctx, bson.M{"_id": postID}, bson.M{"$set": bson.M{
+		"score":            post.Score,
+		"scoreCount":       post.ScoreCount,
+		"upVoteCount":      post.UpvoteCount,
+		"upvotePercentage": post.UpvotePercentage,
+	}})
+}
+
+func RecalculateVotes(post *Post) {
+	post.Score, post.ScoreCount, post.UpvoteCount = 0, 0, 0
+	for _, vote := range post.Votes {
+		if vote == nil || vote.Vote == 0 {
+			continue
+		}
+		post.Score += vote.Vote
+		post.ScoreCount++
+		if vote.Vote > 0 {
+			post.UpvoteCount++
+		}
+	}
+	post.UpvotePercentage = 0
+	if post.ScoreCount > 0 {
+		post.UpvotePercentage = recalculateUpVotePercentage(post)
+	}
+}
+
+// ImportPost сохраняет пост целиком с его ID (восстановление из бэкапа); существующий пост заменяется.
+func (i *ItemMemoryRepository) ImportPost(ctx context.Context, post *Post) error {
+	if post.Comments == nil {
+		post.Comments = make(map[string]Comment)
+	}
+	if post.Votes == nil {
+		post.Votes = make(map[string]*Vote)
+	}
+	if post.URL != "" {
+		post.NormalizedURL, _ = NormalizeURL(post.URL)
+		post.Domain = DomainOf(post.URL)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, err := i.DB.ReplaceOne(ctx, bson.M{"_id": post.ID}, post, options.Replace().SetUpsert(true))
+	return err
+}
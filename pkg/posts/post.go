@@ -2,25 +2,43 @@ package posts
 
 import "time"
 
+var Categories = []string{"music", "funny", "videos", "programming", "news", "fashion"}
+
+func IsCategory(category string) bool {
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// DeletedAuthor подставляется вместо автора удаленного аккаунта.
+var DeletedAuthor = Author{ID: "", Username: "[deleted]"}
+
 type Author struct {
 	ID       string `bson:"id" json:"id"`
 	Username string `bson:"username" json:"username"`
 }
 type PostToFront struct {
 	Author           `json:"author"`
-	Category         string    `json:"category"`
-	Comments         []Comment `json:"comments"`
-	Created          time.Time `json:"created"`
-	ID               string    `json:"id"`
-	Score            int       `json:"score"`
-	UpVote           int       `json:"-"`
-	Title            string    `json:"title"`
-	Type             string    `json:"type"`
-	Text             string    `json:"text,omitempty"`
-	URL              string    `json:"url,omitempty"`
-	UpvotePercentage int       `json:"upvotePercentage"`
-	Views            int       `json:"views"`
-	Votes            []*Vote   `json:"votes"`
+	Category         string     `json:"category"`
+	Comments         []Comment  `json:"comments"`
+	Created          time.Time  `json:"created"`
+	ID               string     `json:"id"`
+	Score            int        `json:"score"`
+	UpVote           int        `json:"-"`
+	Title            string     `json:"title"`
+	Type             string     `json:"type"`
+	Text             string     `json:"text,omitempty"`
+	URL              string     `json:"url,omitempty"`
+	Domain           string     `json:"domain,omitempty"`
+	UpvotePercentage int        `json:"upvotePercentage"`
+	Views            int        `json:"views"`
+	Votes            []*Vote    `json:"votes"`
+	Archived         bool       `json:"archived"`
+	Status           string     `json:"status,omitempty"`
+	PublishAt        *time.Time `json:"publishAt,omitempty"`
 }
 
 type Comment struct {
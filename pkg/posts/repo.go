@@ -1,35 +1,47 @@
 package posts
 
 import (
+	"cmd/redditclone/pkg/logging"
 	"context"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson"
 	_ "go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	_ "go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"log"
 	"sync"
 	"time"
 )
 
 type ItemsRepo interface {
-	GetAll() []*Post
-	AddPost(post *PostToFront)
-	AddComment(postID string, comment Comment) *Post
-	DeleteComment(postID string, commentID string) *Post
-	DeletePost(id string)
-	AddVote(postID string, userID string, vote Vote) *Post
-	DeleteVote(postID string, userID string) *Post
-	FindPost(postID string) (*Post, bool)
+	GetAll(ctx context.Context) []*Post
+	AddPost(ctx context.Context, post *PostToFront)
+	AddComment(ctx context.Context, postID string, comment Comment) *Post
+	DeleteComment(ctx context.Context, postID string, commentID string) *Post
+	DeletePost(ctx context.Context, id string)
+	AddVote(ctx context.Context, postID string, userID string, vote Vote) *Post
+	DeleteVote(ctx context.Context, postID string, userID string) *Post
+	FindPost(ctx context.Context, postID string) (*Post, bool)
+	AddDraft(ctx context.Context, post *PostToFront, publishAt *time.Time)
+	GetDrafts(ctx context.Context, authorID string) []*Post
+	UpdateDraft(ctx context.Context, post *Post) bool
+	SetDraftSchedule(ctx context.Context, postID string, publishAt *time.Time) (*Post, bool)
+	PublishDraft(ctx context.Context, postID string, now time.Time) (*Post, bool)
+	PublishDue(ctx context.Context, now time.Time) []*Post
+	ArchiveOlderThan(ctx context.Context, category string, before time.Time) (int, error)
+	ReplaceAuthor(ctx context.Context, authorID string, replacement Author) error
+	DeleteByAuthor(ctx context.Context, authorID string) error
+	AllPosts(ctx context.Context) []*Post
+	SetRemoved(ctx context.Context, postID string, removed bool) (*Post, bool)
+	RecountVotes(ctx context.Context, postID string) (*Post, bool)
+	ImportPost(ctx context.Context, post *Post) error
 }
 
 type ItemMemoryRepository struct {
 	lastID uint32
 	//Data   map[string]*Post // [PostId]*PostToFront
-	DB  *mongo.Collection
-	Ctx context.Context
-	mu  sync.RWMutex
+	DB *mongo.Collection
+	mu sync.RWMutex
 }
 
 type Post struct {
@@ -45,49 +57,49 @@ type Post struct {
 	Type             string             `bson:"type" json:"type"`
 	Text             string             `bson:"text" json:"text"`
 	URL              string             `bson:"url" json:"url"`
+	NormalizedURL    string             `bson:"normalizedUrl,omitempty" json:"-"`
+	Domain           string             `bson:"domain,omitempty" json:"domain,omitempty"`
 	UpvotePercentage int                `bson:"upvotePercentage" json:"upvotePercentage"`
 	Views            int                `bson:"views" json:"views"`
 	Votes            map[string]*Vote   `bson:"votes" json:"votes"`
+	Status           string             `bson:"status,omitempty" json:"status,omitempty"`
+	PublishAt        *time.Time         `bson:"publishAt,omitempty" json:"publishAt,omitempty"`
+	Archived         bool               `bson:"archived,omitempty" json:"archived"`
+	Removed          bool               `bson:"removed,omitempty" json:"removed,omitempty"`
 }
 
-func NewMemoryRepo() *ItemMemoryRepository {
-	ctx := context.Background()
-	sess, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost"))
-	if err != nil {
-		panic(err)
-	}
-
-	collection := sess.Database("reddit_clone").Collection("posts")
+// NewMemoryRepo хранит посты в Mongo; клиентом владеет вызывающий, он же его и закрывает.
+func NewMemoryRepo(client *mongo.Client, database string) *ItemMemoryRepository {
+	collection := client.Database(database).Collection("posts")
 
 	return &ItemMemoryRepository{
 		lastID: 0,
 		DB:     collection,
-		Ctx:    ctx,
 		//Data:   make(map[string]*Post),
 		mu: sync.RWMutex{},
 	}
 }
 
-func (i *ItemMemoryRepository) GetAll() []*Post {
+func (i *ItemMemoryRepository) GetAll(ctx context.Context) []*Post {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 
 	var posts []*Post
 
-	c, err := i.DB.Find(i.Ctx, bson.M{})
+	c, err := i.DB.Find(ctx, publishedFilter)
 	if err != nil {
 		panic(err)
 	}
-	err = c.All(i.Ctx, &posts)
+	err = c.All(ctx, &posts)
 	if err != nil {
 		panic(err)
 	}
 	return posts
 }
 
-func (i *ItemMemoryRepository) AddComment(postID string, comment Comment) *Post {
+func (i *ItemMemoryRepository) AddComment(ctx context.Context, postID string, comment Comment) *Post {
 
-	post, ok := i.FindPost(postID)
+	post, ok := i.FindPost(ctx, postID)
 	if !ok {
 		return nil
 	}
@@ -95,42 +107,41 @@ func (i *ItemMemoryRepository) AddComment(postID string, comment Comment) *Post
 	commentID := primitive.NewObjectID().Hex()
 	comment.ID = commentID
 	post.Comments[commentID] = comment
-	i.DB.UpdateOne(i.Ctx, bson.M{"_id": postID}, bson.M{"$set": post})
+	i.DB.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$set": post})
 	i.mu.Unlock()
 	return post
 }
 
-func (i *ItemMemoryRepository) DeleteComment(postID string, commentID string) *Post {
-	post, ok := i.FindPost(postID)
+func (i *ItemMemoryRepository) DeleteComment(ctx context.Context, postID string, commentID string) *Post {
+	post, ok := i.FindPost(ctx, postID)
 	if !ok {
 		return nil
 	}
 	i.mu.Lock()
 	delete(post.Comments, commentID)
-	i.DB.UpdateOne(i.Ctx, bson.M{"_id": postID}, bson.M{"$set": post})
+	i.DB.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$set": post})
 	i.mu.Unlock()
 	return post
 }
 
-func (i *ItemMemoryRepository) AddPost(post *PostToFront) {
-	//todo Точно ли нужно сохранять контекст в структуре или можно всегда использовать context.Background()
+func (i *ItemMemoryRepository) AddPost(ctx context.Context, post *PostToFront) {
 	ans := createPost(post)
 	i.mu.Lock()
 	postID := primitive.NewObjectID().Hex()
 	ans.ID = postID
 	post.ID = postID
-	i.DB.InsertOne(i.Ctx, &ans)
+	i.DB.InsertOne(ctx, &ans)
 	i.mu.Unlock()
 }
 
-func (i *ItemMemoryRepository) DeletePost(id string) {
+func (i *ItemMemoryRepository) DeletePost(ctx context.Context, id string) {
 	i.mu.Lock()
-	i.DB.DeleteOne(i.Ctx, bson.M{"_id": id})
+	i.DB.DeleteOne(ctx, bson.M{"_id": id})
 	i.mu.Unlock()
 }
 
-func (i *ItemMemoryRepository) AddVote(postID string, userID string, vote Vote) *Post {
-	post, ok := i.FindPost(postID)
+func (i *ItemMemoryRepository) AddVote(ctx context.Context, postID string, userID string, vote Vote) *Post {
+	post, ok := i.FindPost(ctx, postID)
 	if !ok {
 		return &Post{}
 	}
@@ -139,7 +150,7 @@ func (i *ItemMemoryRepository) AddVote(postID string, userID string, vote Vote)
 	processVoteValue(oldVote, post, vote)
 	post.UpvotePercentage = recalculateUpVotePercentage(post)
 	post.Votes[userID] = &vote
-	i.DB.UpdateOne(i.Ctx, bson.M{"_id": postID}, bson.M{"$set": post})
+	i.DB.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$set": post})
 	i.mu.Unlock()
 	return post
 
@@ -162,11 +173,14 @@ func processVoteValue(oldVote *Vote, post *Post, vote Vote) {
 
 }
 
-func (i *ItemMemoryRepository) DeleteVote(postID string, userID string) *Post {
-	post, ok := i.FindPost(postID)
+func (i *ItemMemoryRepository) DeleteVote(ctx context.Context, postID string, userID string) *Post {
+	post, ok := i.FindPost(ctx, postID)
 	if !ok {
 		return &Post{}
 	}
+	if _, voted := post.Votes[userID]; !voted {
+		return post
+	}
 	i.mu.Lock()
 	post.Score -= post.Votes[userID].Vote
 	post.ScoreCount--
@@ -176,7 +190,7 @@ func (i *ItemMemoryRepository) DeleteVote(postID string, userID string) *Post {
 
 	post.UpvotePercentage = recalculateUpVotePercentage(post)
 	delete(post.Votes, userID)
-	i.DB.UpdateOne(i.Ctx, bson.M{"_id": postID}, bson.M{"$set": post})
+	i.DB.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$set": post})
 	i.mu.Unlock()
 	return post
 }
@@ -189,15 +203,17 @@ func recalculateUpVotePercentage(post *Post) int {
 	return percent
 }
 
-func (i *ItemMemoryRepository) FindPost(id string) (*Post, bool) {
+func (i *ItemMemoryRepository) FindPost(ctx context.Context, id string) (*Post, bool) {
 	i.mu.RLock()
+	defer i.mu.RUnlock()
 	var post *Post
-	err := i.DB.FindOne(i.Ctx, bson.M{"_id": id}).Decode(&post)
+	err := i.DB.FindOne(ctx, bson.M{"_id": id}).Decode(&post)
 	if err != nil {
-		log.Println(err)
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			logging.FromContext(ctx).Error(err)
+		}
 		return nil, false
 	}
-	i.mu.RUnlock()
 	return post, true
 }
 func createPost(front *PostToFront) *Post {
@@ -217,6 +233,11 @@ func createPost(front *PostToFront) *Post {
 		Views:            front.Views,
 		Votes:            make(map[string]*Vote),
 	}
+	if front.URL != "" {
+		answer.NormalizedURL, _ = NormalizeURL(front.URL)
+		answer.Domain = DomainOf(front.URL)
+		front.Domain = answer.Domain
+	}
 	return &answer
 
 }
@@ -246,9 +267,15 @@ func ConstructPostToFront(post *Post) *PostToFront {
 		Type:             post.Type,
 		Text:             post.Text,
 		URL:              post.URL,
+		Domain:           post.LinkDomain(),
 		UpvotePercentage: post.UpvotePercentage,
 		Views:            post.Views,
 		Votes:            votes,
+		PublishAt:        post.PublishAt,
+		Archived:         post.Archived,
+	}
+	if !post.IsPublished() {
+		constructedAnswer.Status = post.Status
 	}
 	return constructedAnswer
 }
@@ -0,0 +1,35 @@
+package posts_test
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/posts/repotest"
+	"cmd/redditclone/pkg/storage"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Mongo в песочнице обычно нет, поэтому тесты идут только с REDDIT_TEST_MONGO_URI.
+func TestMongoRepo(t *testing.T) {
+	uri := os.Getenv("REDDIT_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("REDDIT_TEST_MONGO_URI is not set")
+	}
+	client, err := storage.OpenMongo(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	repotest.Run(t, func(t *testing.T) posts.ItemsRepo {
+		name := strings.NewReplacer("/", "_", " ", "_").Replace(fmt.Sprintf("test_%s_%d", t.Name(), time.Now().UnixNano()))
+		if len(name) > 63 {
+			name = name[len(name)-63:]
+		}
+		t.Cleanup(func() { _ = client.Database(name).Drop(context.Background()) })
+		return posts.NewMemoryRepo(client, name)
+	})
+}
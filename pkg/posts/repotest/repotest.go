@@ -0,0 +1,327 @@
+// Package repotest - общие поведенческие тесты для реализаций posts.ItemsRepo:
+// Mongo и SQL-репозиторий должны вести себя одинаково.
+package repotest
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Run прогоняет набор тестов; newRepo должен возвращать пустой репозиторий.
+func Run(t *testing.T, newRepo func(t *testing.T) posts.ItemsRepo) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo posts.ItemsRepo)
+	}{
+		{"AddAndFindPost", testAddAndFindPost},
+		{"Comments", testComments},
+		{"Votes", testVotes},
+		{"DeletePost", testDeletePost},
+		{"Listing", testListing},
+		{"Scheduling", testScheduling},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newRepo(t))
+		})
+	}
+}
+
+var (
+	alice = posts.Author{ID: "1", Username: "alice"}
+	bob   = posts.Author{ID: "2", Username: "bob"}
+	// базы хранят время с разной точностью
+	created = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func addPost(t *testing.T, repo posts.ItemsRepo, author posts.Author, category, url string) *posts.PostToFront {
+	t.Helper()
+	post := &posts.PostToFront{
+		Author:   author,
+		Category: category,
+		Created:  created,
+		Title:    "title " + category,
+		Type:     "text",
+		Text:     "body",
+		Votes:    []*posts.Vote{},
+	}
+	if url != "" {
+		post.Type, post.Text, post.URL = "link", "", url
+	}
+	repo.AddPost(context.Background(), post)
+	if post.ID == "" {
+		t.Fatal("AddPost did not assign an ID")
+	}
+	return post
+}
+
+func find(t *testing.T, repo posts.ItemsRepo, id string) *posts.Post {
+	t.Helper()
+	post, ok := repo.FindPost(context.Background(), id)
+	if !ok {
+		t.Fatalf("post %s not found", id)
+	}
+	return post
+}
+
+func ids(list []*posts.Post) []string {
+	res := make([]string, 0, len(list))
+	for _, p := range list {
+		res = append(res, p.ID)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func sorted(values ...string) []string {
+	sort.Strings(values)
+	return values
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testAddAndFindPost(t *testing.T, repo posts.ItemsRepo) {
+	text := addPost(t, repo, alice, "music", "")
+	link := addPost(t, repo, bob, "news", "http://WWW.Example.com/story/?utm_source=x")
+	if text.ID == link.ID {
+		t.Fatal("posts got the same ID")
+	}
+
+	got := find(t, repo, text.ID)
+	if got.Author != alice || got.Category != "music" || got.Title != "title music" || got.Text != "body" || got.Type != "text" {
+		t.Errorf("text post round trip: %+v", got)
+	}
+	if !got.Created.Equal(created) {
+		t.Errorf("Created = %v, want %v", got.Created, created)
+	}
+	if !got.IsVisible() || got.Archived || got.Removed {
+		t.Errorf("new post is not visible: %+v", got)
+	}
+	if len(got.Comments) != 0 || len(got.Votes) != 0 || got.Score != 0 {
+		t.Errorf("new post has comments, votes or score: %+v", got)
+	}
+
+	got = find(t, repo, link.ID)
+	if got.Domain != "example.com" || link.Domain != "example.com" {
+		t.Errorf("Domain = %q (front %q), want example.com", got.Domain, link.Domain)
+	}
+	if got.NormalizedURL != "https://example.com/story" {
+		t.Errorf("NormalizedURL = %q", got.NormalizedURL)
+	}
+
+	if _, ok := repo.FindPost(context.Background(), "000000000000000000000000"); ok {
+		t.Error("FindPost found a missing post")
+	}
+}
+
+func testComments(t *testing.T, repo posts.ItemsRepo) {
+	ctx := context.Background()
+	post := addPost(t, repo, alice, "music", "")
+
+	first := repo.AddComment(ctx, post.ID, posts.Comment{Author: bob, Body: "first", Created: created})
+	if first == nil || len(first.Comments) != 1 {
+		t.Fatalf("AddComment returned %+v", first)
+	}
+	second := repo.AddComment(ctx, post.ID, posts.Comment{Author: alice, Body: "second", Created: created.Add(time.Minute)})
+	if second == nil || len(second.Comments) != 2 {
+		t.Fatalf("AddComment returned %+v", second)
+	}
+
+	var firstID string
+	for id, c := range find(t, repo, post.ID).Comments {
+		if c.ID != id || id == "" {
+			t.Errorf("comment key %q and ID %q differ", id, c.ID)
+		}
+		if c.Body == "first" {
+			firstID = id
+			if c.Author != bob || !c.Created.Equal(created) {
+				t.Errorf("comment round trip: %+v", c)
+			}
+		}
+	}
+	if firstID == "" {
+		t.Fatal("first comment is not stored")
+	}
+
+	after := repo.DeleteComment(ctx, post.ID, firstID)
+	if after == nil || len(after.Comments) != 1 {
+		t.Fatalf("DeleteComment returned %+v", after)
+	}
+	if _, ok := find(t, repo, post.ID).Comments[firstID]; ok {
+		t.Error("deleted comment is still stored")
+	}
+
+	if got := repo.AddComment(ctx, "000000000000000000000000", posts.Comment{Author: bob, Body: "x"}); got != nil {
+		t.Errorf("AddComment on a missing post returned %+v", got)
+	}
+	if got := repo.DeleteComment(ctx, "000000000000000000000000", firstID); got != nil {
+		t.Errorf("DeleteComment on a missing post returned %+v", got)
+	}
+}
+
+func testVotes(t *testing.T, repo posts.ItemsRepo) {
+	ctx := context.Background()
+	post := addPost(t, repo, alice, "funny", "")
+	up := posts.Vote{User: alice.ID, Vote: 1}
+	down := posts.Vote{User: bob.ID, Vote: -1}
+
+	steps := []struct {
+		name                       string
+		do                         func() *posts.Post
+		score, count, ups, percent int
+	}{
+		{"alice upvotes", func() *posts.Post { return repo.AddVote(ctx, post.ID, alice.ID, up) }, 1, 1, 1, 100},
+		{"alice upvotes again", func() *posts.Post { return repo.AddVote(ctx, post.ID, alice.ID, up) }, 1, 1, 1, 100},
+		{"bob downvotes", func() *posts.Post { return repo.AddVote(ctx, post.ID, bob.ID, down) }, 0, 2, 1, 50},
+		{"alice switches to downvote", func() *posts.Post {
+			return repo.AddVote(ctx, post.ID, alice.ID, posts.Vote{User: alice.ID, Vote: -1})
+		}, -2, 2, 0, 0},
+		{"bob unvotes", func() *posts.Post { return repo.DeleteVote(ctx, post.ID, bob.ID) }, -1, 1, 0, 0},
+		{"bob unvotes again", func() *posts.Post { return repo.DeleteVote(ctx, post.ID, bob.ID) }, -1, 1, 0, 0},
+		{"alice switches to upvote", func() *posts.Post { return repo.AddVote(ctx, post.ID, alice.ID, up) }, 1, 1, 1, 100},
+	}
+	for _, step := range steps {
+		returned := step.do()
+		stored := find(t, repo, post.ID)
+		for _, got := range []*posts.Post{returned, stored} {
+			if got.Score != step.score || got.ScoreCount != step.count || got.UpvoteCount != step.ups || got.UpvotePercentage != step.percent {
+				t.Fatalf("%s: score=%d count=%d ups=%d percent=%d, want %d %d %d %d", step.name,
+					got.Score, got.ScoreCount, got.UpvoteCount, got.UpvotePercentage,
+					step.score, step.count, step.ups, step.percent)
+			}
+		}
+		if len(stored.Votes) != step.count {
+			t.Fatalf("%s: %d votes stored, want %d", step.name, len(stored.Votes), step.count)
+		}
+	}
+	if v := find(t, repo, post.ID).Votes[alice.ID]; v == nil || v.Vote != 1 || v.User != alice.ID {
+		t.Errorf("stored vote = %+v", v)
+	}
+
+	if got := repo.AddVote(ctx, "000000000000000000000000", alice.ID, up); got == nil || got.ID != "" {
+		t.Errorf("AddVote on a missing post returned %+v", got)
+	}
+	if got := repo.DeleteVote(ctx, "000000000000000000000000", alice.ID); got == nil || got.ID != "" {
+		t.Errorf("DeleteVote on a missing post returned %+v", got)
+	}
+}
+
+func testDeletePost(t *testing.T, repo posts.ItemsRepo) {
+	ctx := context.Background()
+	kept := addPost(t, repo, alice, "music", "")
+	gone := addPost(t, repo, alice, "music", "")
+	repo.AddComment(ctx, gone.ID, posts.Comment{Author: bob, Body: "x", Created: created})
+	repo.AddVote(ctx, gone.ID, bob.ID, posts.Vote{User: bob.ID, Vote: 1})
+
+	repo.DeletePost(ctx, gone.ID)
+	if _, ok := repo.FindPost(ctx, gone.ID); ok {
+		t.Error("deleted post is still found")
+	}
+	if got := ids(repo.GetAll(ctx)); !equal(got, []string{kept.ID}) {
+		t.Errorf("GetAll = %v, want only %s", got, kept.ID)
+	}
+	// удаление несуществующего поста ничего не ломает
+	repo.DeletePost(ctx, gone.ID)
+	find(t, repo, kept.ID)
+}
+
+func testListing(t *testing.T, repo posts.ItemsRepo) {
+	ctx := context.Background()
+	music := addPost(t, repo, alice, "music", "https://example.com/a")
+	news := addPost(t, repo, bob, "news", "https://www.example.com/b")
+	other := addPost(t, repo, bob, "news", "https://other.org/c")
+	hidden := addPost(t, repo, alice, "music", "")
+	draft := &posts.PostToFront{Author: alice, Category: "music", Title: "draft", Type: "text", Text: "t", Created: created}
+	repo.AddDraft(ctx, draft, nil)
+	if draft.ID == "" {
+		t.Fatal("AddDraft did not assign an ID")
+	}
+	if _, ok := repo.SetRemoved(ctx, hidden.ID, true); !ok {
+		t.Fatal("SetRemoved failed")
+	}
+
+	all := repo.GetAll(ctx)
+	if got, want := ids(all), sorted(music.ID, news.ID, other.ID); !equal(got, want) {
+		t.Fatalf("GetAll = %v, want %v (no drafts, no removed posts)", got, want)
+	}
+	if got, want := ids(repo.AllPosts(ctx)), sorted(music.ID, news.ID, other.ID, hidden.ID, draft.ID); !equal(got, want) {
+		t.Errorf("AllPosts = %v, want %v", got, want)
+	}
+	if got := ids(repo.GetDrafts(ctx, alice.ID)); !equal(got, []string{draft.ID}) {
+		t.Errorf("GetDrafts(alice) = %v, want %v", got, []string{draft.ID})
+	}
+	if got := repo.GetDrafts(ctx, bob.ID); len(got) != 0 {
+		t.Errorf("GetDrafts(bob) = %v, want none", ids(got))
+	}
+
+	// так же, как фильтруют обработчики категорий, пользователей и доменов
+	filter := func(keep func(p *posts.Post) bool) []string {
+		var res []*posts.Post
+		for _, p := range all {
+			if keep(p) {
+				res = append(res, p)
+			}
+		}
+		return ids(res)
+	}
+	if got, want := filter(func(p *posts.Post) bool { return p.Category == "news" }), sorted(news.ID, other.ID); !equal(got, want) {
+		t.Errorf("category news = %v, want %v", got, want)
+	}
+	if got, want := filter(func(p *posts.Post) bool { return p.Author.Username == "alice" }), []string{music.ID}; !equal(got, want) {
+		t.Errorf("user alice = %v, want %v", got, want)
+	}
+	if got, want := filter(func(p *posts.Post) bool { return p.LinkDomain() == "example.com" }), sorted(music.ID, news.ID); !equal(got, want) {
+		t.Errorf("domain example.com = %v, want %v", got, want)
+	}
+	if got, want := filter(func(p *posts.Post) bool { return p.CanonicalURL() == "https://example.com/b" }), []string{news.ID}; !equal(got, want) {
+		t.Errorf("canonical url = %v, want %v", got, want)
+	}
+
+	if _, ok := repo.SetRemoved(ctx, hidden.ID, false); !ok {
+		t.Fatal("SetRemoved(false) failed")
+	}
+	if got := len(repo.GetAll(ctx)); got != 4 {
+		t.Errorf("GetAll after restore has %d posts, want 4", got)
+	}
+}
+
+// testScheduling сравнивает даты в запросах: SQLite хранит время строкой.
+func testScheduling(t *testing.T, repo posts.ItemsRepo) {
+	ctx := context.Background()
+	publishAt := created.Add(time.Hour)
+	draft := &posts.PostToFront{Author: alice, Category: "news", Title: "later", Type: "text", Text: "t", Created: created}
+	repo.AddDraft(ctx, draft, &publishAt)
+
+	if got := repo.PublishDue(ctx, publishAt.Add(-time.Second)); len(got) != 0 {
+		t.Fatalf("PublishDue before publish time published %v", ids(got))
+	}
+	got := repo.PublishDue(ctx, publishAt.Add(time.Minute))
+	if len(got) != 1 || got[0].ID != draft.ID || !got[0].IsPublished() {
+		t.Fatalf("PublishDue = %+v, want the scheduled draft", got)
+	}
+	if got := repo.PublishDue(ctx, publishAt.Add(time.Hour)); len(got) != 0 {
+		t.Fatalf("PublishDue published %v twice", ids(got))
+	}
+
+	old := addPost(t, repo, bob, "news", "")
+	n, err := repo.ArchiveOlderThan(ctx, "news", created.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || !find(t, repo, old.ID).Archived || find(t, repo, draft.ID).Archived {
+		t.Errorf("ArchiveOlderThan archived %d posts, want only %s", n, old.ID)
+	}
+}
@@ -0,0 +1,582 @@
+package posts
+
+import (
+	"cmd/redditclone/pkg/logging"
+	"context"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ItemSQLRepository хранит посты в нормализованных таблицах posts, comments и votes
+// (миграция 0005_create_posts), чтобы все приложение могло работать на одной MySQL.
+// jinzhu/gorm не умеет передавать контекст в драйвер, поэтому ctx в методах не используется:
+// время запросов видно только по спанам tracing.ItemsRepo.
+type ItemSQLRepository struct {
+	DB *gorm.DB
+}
+
+func NewSQLRepo(db *gorm.DB) *ItemSQLRepository {
+	return &ItemSQLRepository{DB: db}
+}
+
+type postRow struct {
+	ID               string `gorm:"primary_key"`
+	AuthorID         string `gorm:"index:idx_posts_author"`
+	AuthorUsername   string
+	Category         string `gorm:"index:idx_posts_category_created"`
+	Type             string
+	Title            string
+	Text             string
+	URL              string    `gorm:"column:url"`
+	NormalizedURL    string    `gorm:"column:normalized_url"`
+	Domain           string    `gorm:"index:idx_posts_domain"`
+	Created          time.Time `gorm:"index:idx_posts_category_created"`
+	Score            int
+	ScoreCount       int
+	UpvoteCount      int
+	UpvotePercentage int
+	Views            int
+	Status           string     `gorm:"index:idx_posts_status_publish_at"`
+	PublishAt        *time.Time `gorm:"index:idx_posts_status_publish_at"`
+	Archived         bool
+	Removed          bool
+}
+
+func (postRow) TableName() string {
+	return "posts"
+}
+
+type commentRow struct {
+	ID             string `gorm:"primary_key"`
+	PostID         string `gorm:"index:idx_comments_post"`
+	AuthorID       string `gorm:"index:idx_comments_author"`
+	AuthorUsername string
+	Body           string
+	Created        time.Time
+}
+
+func (commentRow) TableName() string {
+	return "comments"
+}
+
+type voteRow struct {
+	PostID string `gorm:"primary_key"`
+	UserID string `gorm:"primary_key;index:idx_votes_user"`
+	Vote   int
+}
+
+func (voteRow) TableName() string {
+	return "votes"
+}
+
+var errNotMatched = errors.New("post not found or does not match condition")
+
+func toRow(post *Post) postRow {
+	return postRow{
+		ID:               post.ID,
+		AuthorID:         post.Author.ID,
+		AuthorUsername:   post.Author.Username,
+		Category:         post.Category,
+		Type:             post.Type,
+		Title:            post.Title,
+		Text:             post.Text,
+		URL:              post.URL,
+		NormalizedURL:    post.NormalizedURL,
+		Domain:           post.Domain,
+		Created:          post.Created,
+		Score:            post.Score,
+		ScoreCount:       post.ScoreCount,
+		UpvoteCount:      post.UpvoteCount,
+		UpvotePercentage: post.UpvotePercentage,
+		Views:            post.Views,
+		Status:           post.Status,
+		PublishAt:        post.PublishAt,
+		Archived:         post.Archived,
+		Removed:          post.Removed,
+	}
+}
+
+func (r *postRow) toPost() *Post {
+	return &Post{
+		Author:           Author{ID: r.AuthorID, Username: r.AuthorUsername},
+		Category:         r.Category,
+		Comments:         make(map[string]Comment),
+		Created:          r.Created,
+		ID:               r.ID,
+		Score:            r.Score,
+		ScoreCount:       r.ScoreCount,
+		UpvoteCount:      r.UpvoteCount,
+		Title:            r.Title,
+		Type:             r.Type,
+		Text:             r.Text,
+		URL:              r.URL,
+		NormalizedURL:    r.NormalizedURL,
+		Domain:           r.Domain,
+		UpvotePercentage: r.UpvotePercentage,
+		Views:            r.Views,
+		Votes:            make(map[string]*Vote),
+		Status:           r.Status,
+		PublishAt:        r.PublishAt,
+		Archived:         r.Archived,
+		Removed:          r.Removed,
+	}
+}
+
+// find загружает посты по условию вместе с комментариями и голосами - тремя запросами на всю выборку.
+func find(db *gorm.DB, where string, args ...interface{}) ([]*Post, error) {
+	var rows []postRow
+	query := db
+	if where != "" {
+		query = db.Where(where, args...)
+	}
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	posts := make([]*Post, 0, len(rows))
+	byID := make(map[string]*Post, len(rows))
+	ids := make([]string, 0, len(rows))
+	for idx := range rows {
+		post := rows[idx].toPost()
+		posts = append(posts, post)
+		byID[post.ID] = post
+		ids = append(ids, post.ID)
+	}
+
+	var comments []commentRow
+	if err := db.Where("post_id IN (?)", ids).Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range comments {
+		byID[c.PostID].Comments[c.ID] = Comment{
+			Author:  Author{ID: c.AuthorID, Username: c.AuthorUsername},
+			Body:    c.Body,
+			Created: c.Created,
+			ID:      c.ID,
+		}
+	}
+
+	var votes []voteRow
+	if err := db.Where("post_id IN (?)", ids).Find(&votes).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range votes {
+		byID[v.PostID].Votes[v.UserID] = &Vote{User: v.UserID, Vote: v.Vote}
+	}
+	return posts, nil
+}
+
+func findOne(db *gorm.DB, postID string) (*Post, error) {
+	found, err := find(db, "id = ?", postID)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, errNotMatched
+	}
+	return found[0], nil
+}
+
+// logError пишет ошибку базы в лог запроса; отсутствие поста ошибкой не считается.
+func logError(ctx context.Context, err error) {
+	if !errors.Is(err, errNotMatched) {
+		logging.FromContext(ctx).Error(err)
+	}
+}
+
+// AutoMigrate создает таблицы постов там, где нет SQL-миграций (встроенный SQLite).
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(&postRow{}, &commentRow{}, &voteRow{}).Error
+}
+
+// lockPost блокирует строку поста до конца транзакции, чтобы параллельные голоса
+// не затирали счетчики друг друга. SQLite не знает FOR UPDATE, но он и так
+// пропускает одну пишущую транзакцию за раз.
+func lockPost(tx *gorm.DB, postID string, where string, args ...interface{}) (*Post, error) {
+	query := tx.Where("id = ?", postID)
+	if tx.Dialect().GetName() != "sqlite3" {
+		query = query.Set("gorm:query_option", "FOR UPDATE")
+	}
+	if where != "" {
+		query = query.Where(where, args...)
+	}
+	var row postRow
+	if err := query.First(&row).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, errNotMatched
+		}
+		return nil, err
+	}
+	return findOne(tx, postID)
+}
+
+func (i *ItemSQLRepository) transaction(fn func(tx *gorm.DB) error) error {
+	tx := i.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func saveCounters(tx *gorm.DB, post *Post) error {
+	return tx.Model(&postRow{ID: post.ID}).Updates(map[string]interface{}{
+		"score":             post.Score,
+		"score_count":       post.ScoreCount,
+		"upvote_count":      post.UpvoteCount,
+		"upvote_percentage": post.UpvotePercentage,
+	}).Error
+}
+
+func insertPost(tx *gorm.DB, post *Post) error {
+	row := toRow(post)
+	if err := tx.Create(&row).Error; err != nil {
+		return err
+	}
+	for id, c := range post.Comments {
+		comment := commentRow{ID: id, PostID: post.ID, AuthorID: c.Author.ID, AuthorUsername: c.Author.Username, Body: c.Body, Created: c.Created}
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+	}
+	for userID, v := range post.Votes {
+		if v == nil {
+			continue
+		}
+		vote := voteRow{PostID: post.ID, UserID: userID, Vote: v.Vote}
+		if err := tx.Create(&vote).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePosts удаляет посты вместе с комментариями и голосами явно, не полагаясь на внешние ключи.
+func deletePosts(tx *gorm.DB, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("post_id IN (?)", ids).Delete(voteRow{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("post_id IN (?)", ids).Delete(commentRow{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN (?)", ids).Delete(postRow{}).Error
+}
+
+const publishedWhere = "status NOT IN (?) AND removed = ?"
+
+var unpublishedStatuses = []string{StatusDraft, StatusScheduled}
+
+func (i *ItemSQLRepository) GetAll(ctx context.Context) []*Post {
+	all, err := find(i.DB, publishedWhere, unpublishedStatuses, false)
+	if err != nil {
+		panic(err)
+	}
+	return all
+}
+
+func (i *ItemSQLRepository) AllPosts(ctx context.Context) []*Post {
+	all, err := find(i.DB, "")
+	if err != nil {
+		logError(ctx, err)
+		return nil
+	}
+	return all
+}
+
+func (i *ItemSQLRepository) FindPost(ctx context.Context, postID string) (*Post, bool) {
+	post, err := findOne(i.DB, postID)
+	if err != nil {
+		logError(ctx, err)
+		return nil, false
+	}
+	return post, true
+}
+
+func (i *ItemSQLRepository) AddPost(ctx context.Context, post *PostToFront) {
+	ans := createPost(post)
+	ans.ID = primitive.NewObjectID().Hex()
+	post.ID = ans.ID
+	if err := i.transaction(func(tx *gorm.DB) error { return insertPost(tx, ans) }); err != nil {
+		logError(ctx, err)
+	}
+}
+
+func (i *ItemSQLRepository) DeletePost(ctx context.Context, id string) {
+	if err := i.transaction(func(tx *gorm.DB) error { return deletePosts(tx, []string{id}) }); err != nil {
+		logError(ctx, err)
+	}
+}
+
+// AddComment проверяет пост и пишет комментарий в одной транзакции, чтобы
+// параллельное удаление поста не оставило комментарий без поста.
+func (i *ItemSQLRepository) AddComment(ctx context.Context, postID string, comment Comment) *Post {
+	var post *Post
+	err := i.transaction(func(tx *gorm.DB) error {
+		var err error
+		if post, err = lockPost(tx, postID, ""); err != nil {
+			return err
+		}
+		comment.ID = primitive.NewObjectID().Hex()
+		row := commentRow{
+			ID:             comment.ID,
+			PostID:         postID,
+			AuthorID:       comment.Author.ID,
+			AuthorUsername: comment.Author.Username,
+			Body:           comment.Body,
+			Created:        comment.Created,
+		}
+		if err = tx.Create(&row).Error; err != nil {
+			return err
+		}
+		post.Comments[comment.ID] = comment
+		return nil
+	})
+	if err != nil {
+		logError(ctx, err)
+		return nil
+	}
+	return post
+}
+
+func (i *ItemSQLRepository) DeleteComment(ctx context.Context, postID string, commentID string) *Post {
+	var post *Post
+	err := i.transaction(func(tx *gorm.DB) error {
+		var err error
+		if post, err = lockPost(tx, postID, ""); err != nil {
+			return err
+		}
+		if err = tx.Where("id = ? AND post_id = ?", commentID, postID).Delete(commentRow{}).Error; err != nil {
+			return err
+		}
+		delete(post.Comments, commentID)
+		return nil
+	})
+	if err != nil {
+		logError(ctx, err)
+		return nil
+	}
+	return post
+}
+
+func (i *ItemSQLRepository) AddVote(ctx context.Context, postID string, userID string, vote Vote) *Post {
+	var post *Post
+	err := i.transaction(func(tx *gorm.DB) error {
+		var err error
+		if post, err = lockPost(tx, postID, ""); err != nil {
+			return err
+		}
+		processVoteValue(post.Votes[userID], post, vote)
+		post.UpvotePercentage = recalculateUpVotePercentage(post)
+		post.Votes[userID] = &vote
+		if err = tx.Where("post_id = ? AND user_id = ?", postID, userID).Delete(voteRow{}).Error; err != nil {
+			return err
+		}
+		if err = tx.Create(&voteRow{PostID: postID, UserID: userID, Vote: vote.Vote}).Error; err != nil {
+			return err
+		}
+		return saveCounters(tx, post)
+	})
+	if err != nil {
+		logError(ctx, err)
+		return &Post{}
+	}
+	return post
+}
+
+func (i *ItemSQLRepository) DeleteVote(ctx context.Context, postID string, userID string) *Post {
+	var post *Post
+	err := i.transaction(func(tx *gorm.DB) error {
+		var err error
+		if post, err = lockPost(tx, postID, ""); err != nil {
+			return err
+		}
+		old, voted := post.Votes[userID]
+		if !voted {
+			return nil
+		}
+		post.Score -= old.Vote
+		post.ScoreCount--
+		if old.Vote == 1 {
+			post.UpvoteCount--
+		}
+		post.UpvotePercentage = recalculateUpVotePercentage(post)
+		delete(post.Votes, userID)
+		if err = tx.Where("post_id = ? AND user_id = ?", postID, userID).Delete(voteRow{}).Error; err != nil {
+			return err
+		}
+		return saveCounters(tx, post)
+	})
+	if err != nil {
+		logError(ctx, err)
+		return &Post{}
+	}
+	return post
+}
+
+func (i *ItemSQLRepository) RecountVotes(ctx context.Context, postID string) (*Post, bool) {
+	var post *Post
+	err := i.transaction(func(tx *gorm.DB) error {
+		var err error
+		if post, err = lockPost(tx, postID, ""); err != nil {
+			return err
+		}
+		RecalculateVotes(post)
+		return saveCounters(tx, post)
+	})
+	if err != nil {
+		logError(ctx, err)
+		return nil, false
+	}
+	return post, true
+}
+
+// updateWhere меняет поля поста, только если он подходит под условие. Проверка и запись идут
+// в одной транзакции под блокировкой строки, поэтому, например, публикация черновика атомарна.
+func (i *ItemSQLRepository) updateWhere(ctx context.Context, postID string, fields map[string]interface{}, where string, args ...interface{}) (*Post, bool) {
+	err := i.transaction(func(tx *gorm.DB) error {
+		if _, err := lockPost(tx, postID, where, args...); err != nil {
+			return err
+		}
+		return tx.Model(&postRow{ID: postID}).Updates(fields).Error
+	})
+	if err != nil {
+		logError(ctx, err)
+		return nil, false
+	}
+	return i.FindPost(ctx, postID)
+}
+
+func (i *ItemSQLRepository) AddDraft(ctx context.Context, post *PostToFront, publishAt *time.Time) {
+	ans := createPost(post)
+	ans.Status = StatusDraft
+	if publishAt != nil {
+		ans.Status = StatusScheduled
+		ans.PublishAt = publishAt
+	}
+	ans.ID = primitive.NewObjectID().Hex()
+	post.ID = ans.ID
+	post.Status = ans.Status
+	post.PublishAt = ans.PublishAt
+	if err := i.transaction(func(tx *gorm.DB) error { return insertPost(tx, ans) }); err != nil {
+		logError(ctx, err)
+	}
+}
+
+func (i *ItemSQLRepository) GetDrafts(ctx context.Context, authorID string) []*Post {
+	drafts, err := find(i.DB, "author_id = ? AND status IN (?)", authorID, unpublishedStatuses)
+	if err != nil {
+		logError(ctx, err)
+		return nil
+	}
+	return drafts
+}
+
+func (i *ItemSQLRepository) UpdateDraft(ctx context.Context, post *Post) bool {
+	post.NormalizedURL, post.Domain = "", ""
+	if post.URL != "" {
+		post.NormalizedURL, _ = NormalizeURL(post.URL)
+		post.Domain = DomainOf(post.URL)
+	}
+	_, ok := i.updateWhere(ctx, post.ID, map[string]interface{}{
+		"category":       post.Category,
+		"title":          post.Title,
+		"type":           post.Type,
+		"text":           post.Text,
+		"url":            post.URL,
+		"normalized_url": post.NormalizedURL,
+		"domain":         post.Domain,
+	}, "status IN (?)", unpublishedStatuses)
+	return ok
+}
+
+func (i *ItemSQLRepository) SetDraftSchedule(ctx context.Context, postID string, publishAt *time.Time) (*Post, bool) {
+	fields := map[string]interface{}{"status": StatusDraft, "publish_at": nil}
+	if publishAt != nil {
+		fields = map[string]interface{}{"status": StatusScheduled, "publish_at": publishAt}
+	}
+	return i.updateWhere(ctx, postID, fields, "status IN (?)", unpublishedStatuses)
+}
+
+func (i *ItemSQLRepository) PublishDraft(ctx context.Context, postID string, now time.Time) (*Post, bool) {
+	return i.updateWhere(ctx, postID, publishFields(now), "status IN (?)", unpublishedStatuses)
+}
+
+func (i *ItemSQLRepository) PublishDue(ctx context.Context, now time.Time) []*Post {
+	var ids []string
+	err := i.DB.Model(&postRow{}).Where("status = ? AND publish_at <= ?", StatusScheduled, now).Pluck("id", &ids).Error
+	if err != nil {
+		logError(ctx, err)
+		return nil
+	}
+	published := make([]*Post, 0, len(ids))
+	for _, id := range ids {
+		post, ok := i.updateWhere(ctx, id, publishFields(now), "status = ? AND publish_at <= ?", StatusScheduled, now)
+		if ok {
+			published = append(published, post)
+		}
+	}
+	return published
+}
+
+func publishFields(now time.Time) map[string]interface{} {
+	return map[string]interface{}{"status": StatusPublished, "created": now, "publish_at": nil}
+}
+
+func (i *ItemSQLRepository) ArchiveOlderThan(ctx context.Context, category string, before time.Time) (int, error) {
+	res := i.DB.Model(&postRow{}).
+		Where("category = ? AND created < ? AND archived = ?", category, before, false).
+		Where(publishedWhere, unpublishedStatuses, false).
+		UpdateColumn("archived", true)
+	return int(res.RowsAffected), res.Error
+}
+
+func (i *ItemSQLRepository) SetRemoved(ctx context.Context, postID string, removed bool) (*Post, bool) {
+	return i.updateWhere(ctx, postID, map[string]interface{}{"removed": removed}, "")
+}
+
+func (i *ItemSQLRepository) ReplaceAuthor(ctx context.Context, authorID string, replacement Author) error {
+	fields := map[string]interface{}{"author_id": replacement.ID, "author_username": replacement.Username}
+	return i.transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&postRow{}).Where("author_id = ?", authorID).UpdateColumns(fields).Error; err != nil {
+			return err
+		}
+		return tx.Model(&commentRow{}).Where("author_id = ?", authorID).UpdateColumns(fields).Error
+	})
+}
+
+func (i *ItemSQLRepository) DeleteByAuthor(ctx context.Context, authorID string) error {
+	return i.transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Model(&postRow{}).Where("author_id = ?", authorID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if err := deletePosts(tx, ids); err != nil {
+			return err
+		}
+		return tx.Where("author_id = ?", authorID).Delete(commentRow{}).Error
+	})
+}
+
+func (i *ItemSQLRepository) ImportPost(ctx context.Context, post *Post) error {
+	if post.URL != "" {
+		post.NormalizedURL, _ = NormalizeURL(post.URL)
+		post.Domain = DomainOf(post.URL)
+	}
+	return i.transaction(func(tx *gorm.DB) error {
+		if err := deletePosts(tx, []string{post.ID}); err != nil {
+			return err
+		}
+		return insertPost(tx, post)
+	})
+}
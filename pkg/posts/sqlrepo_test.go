@@ -0,0 +1,19 @@
+package posts_test
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/posts/repotest"
+	"cmd/redditclone/pkg/storage"
+	"testing"
+)
+
+func TestSQLRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) posts.ItemsRepo {
+		db, err := storage.OpenSQLite(":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return posts.NewSQLRepo(db)
+	})
+}
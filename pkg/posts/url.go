@@ -0,0 +1,99 @@
+package posts
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var ErrBadURL = errors.New("url must be an absolute http or https link")
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+var trackingParams = map[string]struct{}{
+	"fbclid":  {},
+	"gclid":   {},
+	"yclid":   {},
+	"igshid":  {},
+	"mc_cid":  {},
+	"mc_eid":  {},
+	"ref_src": {},
+	"_ga":     {},
+}
+
+// NormalizeURL приводит ссылку к каноническому виду для поиска дубликатов:
+// схема всегда https, хост в нижнем регистре без www. и порта по умолчанию для исходной схемы,
+// без завершающих слешей, фрагмента и трекинговых параметров, остальные параметры отсортированы.
+func NormalizeURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", ErrBadURL
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme != "http" && scheme != "https") || u.Host == "" {
+		return "", ErrBadURL
+	}
+
+	host := NormalizeHost(u.Hostname())
+	if port := u.Port(); port != "" && port != defaultPorts[scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	query := u.Query()
+	for key := range query {
+		if _, ok := trackingParams[strings.ToLower(key)]; ok || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+
+	normalized := url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     strings.TrimRight(u.Path, "/"),
+		RawPath:  strings.TrimRight(u.EscapedPath(), "/"),
+		RawQuery: query.Encode(),
+	}
+	return normalized.String(), nil
+}
+
+func NormalizeHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	return strings.TrimPrefix(host, "www.")
+}
+
+// DomainOf возвращает нормализованный хост ссылки или пустую строку, если ссылка некорректна.
+func DomainOf(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+	return NormalizeHost(u.Hostname())
+}
+
+// CanonicalURL возвращает сохраненный нормализованный URL, а для старых постов вычисляет его.
+func (p *Post) CanonicalURL() string {
+	if p.NormalizedURL != "" {
+		return p.NormalizedURL
+	}
+	if p.URL == "" {
+		return ""
+	}
+	normalized, err := NormalizeURL(p.URL)
+	if err != nil {
+		return ""
+	}
+	return normalized
+}
+
+func (p *Post) LinkDomain() string {
+	if p.Domain != "" {
+		return p.Domain
+	}
+	return DomainOf(p.URL)
+}
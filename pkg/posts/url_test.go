@@ -0,0 +1,79 @@
+package posts
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{"http://example.com/a", "https://example.com/a"},
+		{"  HTTPS://WWW.Example.COM/a/  ", "https://example.com/a"},
+		{"https://example.com.", "https://example.com"},
+		{"https://example.com/", "https://example.com"},
+		{"https://example.com/a#section", "https://example.com/a"},
+		{"https://example.com/a?utm_source=x&UTM_Medium=y&fbclid=1&id=5", "https://example.com/a?id=5"},
+		{"https://example.com/a?b=2&a=1", "https://example.com/a?a=1&b=2"},
+		{"https://example.com/a%2Fb/", "https://example.com/a%2Fb"},
+		// порт по умолчанию убирается только для своей схемы
+		{"http://example.com:80/a", "https://example.com/a"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"https://example.com:80/a", "https://example.com:80/a"},
+		{"http://example.com:443/a", "https://example.com:443/a"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+		{"http://[::1]:8080/a", "https://[::1]:8080/a"},
+		{"http://[::1]:80/a", "https://[::1]/a"},
+	}
+	for _, tc := range cases {
+		got, err := NormalizeURL(tc.in)
+		if err != nil {
+			t.Errorf("NormalizeURL(%q): %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeURLDistinguishesPorts(t *testing.T) {
+	plain, _ := NormalizeURL("https://example.com/")
+	for _, raw := range []string{"https://example.com:80/", "http://example.com:443/"} {
+		got, err := NormalizeURL(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == plain {
+			t.Errorf("NormalizeURL(%q) collapsed into %q", raw, plain)
+		}
+	}
+}
+
+func TestNormalizeURLRejects(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"example.com/a",
+		"/relative/path",
+		"ftp://example.com/file",
+		"javascript:alert(1)",
+		"https://",
+		"http://exa mple.com/%zz",
+	} {
+		if got, err := NormalizeURL(raw); err != ErrBadURL {
+			t.Errorf("NormalizeURL(%q) = %q, %v; want ErrBadURL", raw, got, err)
+		}
+	}
+}
+
+func TestDomainOf(t *testing.T) {
+	cases := map[string]string{
+		"https://www.Example.com/a":  "example.com",
+		"http://news.example.com:80": "news.example.com",
+		"not a url%zz":               "",
+	}
+	for in, want := range cases {
+		if got := DomainOf(in); got != want {
+			t.Errorf("DomainOf(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
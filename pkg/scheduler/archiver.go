@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+const DefaultArchiveInterval = time.Hour
+
+// Archiver периодически помечает старые посты архивными пачкой по каждой категории.
+type Archiver struct {
+	ItemsRepo posts.ItemsRepo
+	Policy    posts.ArchivePolicy
+	Logger    *zap.SugaredLogger
+	Interval  time.Duration
+}
+
+func (a *Archiver) Run(ctx context.Context) {
+	interval := a.Interval
+	if interval <= 0 {
+		interval = DefaultArchiveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	a.archive(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.archive(ctx)
+		}
+	}
+}
+
+func (a *Archiver) archive(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "scheduler.archive")
+	defer span.End()
+	now := time.Now()
+	for _, category := range posts.Categories {
+		age := a.Policy.MaxAge(category)
+		if age <= 0 {
+			continue
+		}
+		n, err := a.ItemsRepo.ArchiveOlderThan(ctx, category, now.Add(-age))
+		if err != nil {
+			a.Logger.Errorf("Не удалось архивировать посты в %s: %v", category, err)
+			continue
+		}
+		if n > 0 {
+			a.Logger.Infof("Архивировано %d постов в %s", n, category)
+		}
+	}
+}
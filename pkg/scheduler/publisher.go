@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+	"time"
+)
+
+const DefaultPublishInterval = 30 * time.Second
+
+var tracer = otel.Tracer("cmd/redditclone/pkg/scheduler")
+
+// Publisher периодически публикует запланированные черновики. Состояние хранится в самом
+// репозитории, поэтому после рестарта просроченные черновики публикуются при первом запуске,
+// а атомарная смена статуса не дает опубликовать черновик дважды даже с несколькими инстансами.
+type Publisher struct {
+	ItemsRepo posts.ItemsRepo
+	Logger    *zap.SugaredLogger
+	Interval  time.Duration
+}
+
+func (p *Publisher) Run(ctx context.Context) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultPublishInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	p.publishDue(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.publishDue(ctx)
+		}
+	}
+}
+
+func (p *Publisher) publishDue(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "scheduler.publishDue")
+	defer span.End()
+	published := p.ItemsRepo.PublishDue(ctx, time.Now())
+	for _, post := range published {
+		p.Logger.Infof("Запланированный пост %s опубликован", post.ID)
+	}
+}
@@ -0,0 +1,184 @@
+package seed
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Options struct {
+	Users       int
+	Posts       int
+	MaxComments int
+	Password    string
+	Seed        int64
+	// Now - точка отсчета для дат постов; с фиксированным Now результат полностью воспроизводим
+	Now  time.Time
+	Span time.Duration
+}
+
+type Result struct {
+	Users int
+	// ReusedUsers - пользователи, созданные прошлым запуском с тем же Seed
+	ReusedUsers int
+	Posts       int
+	Comments    int
+	Votes       int
+}
+
+// Generator наполняет любые реализации UserRepo и ItemsRepo правдоподобными данными.
+// При одинаковом Seed генерируются одни и те же логины, посты, комментарии и голоса.
+// Повторный запуск не падает на занятых логинах, а переиспользует этих пользователей.
+type Generator struct {
+	UserRepo  user.UserRepo
+	ItemsRepo posts.ItemsRepo
+}
+
+func (g *Generator) Run(ctx context.Context, opts Options) (Result, error) {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Span <= 0 {
+		opts.Span = 30 * 24 * time.Hour
+	}
+	if opts.Password == "" {
+		opts.Password = "password"
+	}
+	r := rand.New(rand.NewSource(opts.Seed))
+	var res Result
+
+	authors := make([]posts.Author, 0, opts.Users)
+	taken := map[string]bool{}
+	for len(authors) < opts.Users {
+		login := uniqueLogin(r, taken)
+		u, err := g.UserRepo.SignUp(ctx, login, opts.Password)
+		switch {
+		case errors.Is(err, user.ErrExists):
+			if u, err = g.UserRepo.GetUser(ctx, login); err != nil {
+				return res, fmt.Errorf("get user %s: %w", login, err)
+			}
+			res.ReusedUsers++
+		case err != nil:
+			return res, fmt.Errorf("sign up %s: %w", login, err)
+		default:
+			res.Users++
+		}
+		authors = append(authors, posts.Author{ID: strconv.Itoa(u.ID), Username: u.Login})
+	}
+	if len(authors) == 0 {
+		return res, nil
+	}
+
+	for i := 0; i < opts.Posts; i++ {
+		category := posts.Categories[i%len(posts.Categories)]
+		created := opts.Now.Add(-time.Duration(r.Int63n(int64(opts.Span))))
+		post := g.newPost(r, authors[r.Intn(len(authors))], category, created)
+		g.ItemsRepo.AddPost(ctx, post)
+		res.Posts++
+
+		res.Comments += g.addComments(ctx, r, post, authors, opts)
+		res.Votes += g.addVotes(ctx, r, post.ID, authors)
+	}
+	return res, nil
+}
+
+func (g *Generator) newPost(r *rand.Rand, aut posts.Author, category string, created time.Time) *posts.PostToFront {
+	topic := pick(r, topics[category])
+	title := fmt.Sprintf(pick(r, titleTemplates), topic)
+	title = strings.ToUpper(title[:1]) + title[1:]
+
+	post := &posts.PostToFront{
+		Author:   aut,
+		Category: category,
+		Comments: make([]posts.Comment, 0),
+		Created:  created,
+		Title:    title,
+		Votes:    []*posts.Vote{},
+	}
+	if r.Intn(2) == 0 {
+		post.Type = "link"
+		slug := strings.ReplaceAll(strings.ToLower(topic), " ", "-")
+		post.URL = fmt.Sprintf("https://%s/%s/%d", pick(r, domains), slug, r.Intn(100000))
+	} else {
+		post.Type = "text"
+		post.Text = paragraph(r, 2+r.Intn(4))
+	}
+	return post
+}
+
+func (g *Generator) addComments(ctx context.Context, r *rand.Rand, post *posts.PostToFront, authors []posts.Author, opts Options) int {
+	if opts.MaxComments <= 0 {
+		return 0
+	}
+	// большинство постов почти без комментариев, немногие - с длинными тредами
+	n := int(math.Pow(r.Float64(), 2) * float64(opts.MaxComments+1))
+	created := post.Created
+	for c := 0; c < n; c++ {
+		created = created.Add(time.Duration(1+r.Intn(180)) * time.Minute)
+		if created.After(opts.Now) {
+			created = opts.Now
+		}
+		g.ItemsRepo.AddComment(ctx, post.ID, posts.Comment{
+			Author:  authors[r.Intn(len(authors))],
+			Body:    paragraph(r, 1+r.Intn(2)),
+			Created: created,
+		})
+	}
+	return n
+}
+
+// addVotes: у каждого поста своя "популярность" (доля проголосовавших) и "качество"
+// (вероятность апвоута), поэтому Score и UpvotePercentage получаются разнообразными.
+func (g *Generator) addVotes(ctx context.Context, r *rand.Rand, postID string, authors []posts.Author) int {
+	popularity := 0.05 + 0.6*math.Pow(r.Float64(), 2)
+	quality := clamp(0.72+0.18*r.NormFloat64(), 0.05, 0.99)
+	n := 0
+	for _, a := range authors {
+		if r.Float64() > popularity {
+			continue
+		}
+		value := -1
+		if r.Float64() < quality {
+			value = 1
+		}
+		g.ItemsRepo.AddVote(ctx, postID, a.ID, posts.Vote{User: a.ID, Vote: value})
+		n++
+	}
+	return n
+}
+
+func uniqueLogin(r *rand.Rand, taken map[string]bool) string {
+	for {
+		login := pick(r, adjectives) + "_" + pick(r, nouns)
+		if r.Intn(3) > 0 {
+			login += strconv.Itoa(r.Intn(1000))
+		}
+		if !taken[login] {
+			taken[login] = true
+			return login
+		}
+	}
+}
+
+func paragraph(r *rand.Rand, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = pick(r, sentences)
+	}
+	return strings.Join(parts, " ")
+}
+
+func pick(r *rand.Rand, items []string) string {
+	return items[r.Intn(len(items))]
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
@@ -0,0 +1,47 @@
+package seed
+
+var (
+	adjectives = []string{
+		"quiet", "brave", "lazy", "curious", "sleepy", "happy", "grumpy", "clever", "wild", "fuzzy",
+		"rusty", "shiny", "cosmic", "silent", "rapid", "lucky", "dusty", "golden", "frosty", "mellow",
+	}
+	nouns = []string{
+		"otter", "falcon", "panda", "gopher", "badger", "walrus", "lynx", "raven", "koala", "moose",
+		"penguin", "beaver", "fox", "heron", "yak", "marmot", "squid", "tiger", "wombat", "ferret",
+	}
+	topics = map[string][]string{
+		"music":       {"vinyl pressing", "jazz standards", "synthwave", "live album", "guitar tone", "film scores"},
+		"funny":       {"my cat", "office printer", "autocorrect", "a pigeon", "my grandma", "the self-checkout"},
+		"videos":      {"timelapse", "drone footage", "speedrun", "documentary", "stop motion", "a tiny house tour"},
+		"programming": {"Go generics", "database indexes", "code review", "a memory leak", "unit tests", "Kubernetes"},
+		"news":        {"city council", "space launch", "climate report", "transit strike", "new library", "rail line"},
+		"fashion":     {"thrifted jacket", "capsule wardrobe", "sneaker drop", "linen shirts", "vintage denim", "knitwear"},
+	}
+	titleTemplates = []string{
+		"What do you think about %s?",
+		"I finally tried %s and here is what happened",
+		"Unpopular opinion: %s is overrated",
+		"TIL something surprising about %s",
+		"%s appreciation thread",
+		"Need advice on %s",
+		"The best thing I learned about %s this year",
+	}
+	domains = []string{
+		"example.com", "news.example.org", "blog.example.net", "youtube.com", "github.com",
+		"medium.com", "wikipedia.org", "nytimes.com", "bbc.co.uk", "vimeo.com",
+	}
+	sentences = []string{
+		"Honestly this made my day.",
+		"I have been thinking about this for weeks.",
+		"Can someone explain why this works?",
+		"Came here to say exactly this.",
+		"This is the content I am here for.",
+		"Source? I would love to read more.",
+		"Hard disagree, but I see where you are coming from.",
+		"We tried the same thing last year and it went badly.",
+		"Saving this for later.",
+		"Underrated post, more people need to see it.",
+		"The details in this are incredible.",
+		"I laughed way harder than I should have.",
+	}
+)
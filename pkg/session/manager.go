@@ -1,26 +1,22 @@
 package session
 
 import (
-	"errors"
+	"context"
 	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel"
 	"net/http"
 	"sync"
 	"time"
 )
 
+var tracer = otel.Tracer("cmd/redditclone/pkg/session")
+
 type SessionsManager struct {
 	DB *gorm.DB
 	mu *sync.RWMutex
 }
 
-func NewSessionsManager() *SessionsManager {
-	dsn := "root:@tcp(localhost:3306)/reddit_clone?parseTime=true"
-	db, err := gorm.Open("mysql", dsn)
-	if err != nil {
-		panic(err)
-	}
-	db.DB()
-	db.DB().Ping()
+func NewSessionsManager(db *gorm.DB) *SessionsManager {
 	return &SessionsManager{
 		DB: db,
 		//data: make(map[string]*Session, 10),
@@ -28,42 +24,47 @@ func NewSessionsManager() *SessionsManager {
 	}
 }
 
-func (sm *SessionsManager) Check(r *http.Request) (*Session, error) {
-	sessionCookie, err := r.Cookie("token")
-	if errors.Is(err, http.ErrNoCookie) {
-		return nil, ErrNoAuth
-	}
+// Check находит сессию по токену. Отозванная (удаленная) сессия - ErrNoAuth, даже если токен еще не истек.
+func (sm *SessionsManager) Check(ctx context.Context, token string) (*Session, error) {
+	_, span := tracer.Start(ctx, "session.Check")
+	defer span.End()
 	var sess Session
 	sm.mu.RLock()
-	if result := sm.DB.Where("token = ?", sessionCookie.Value).First(&sess); result.Error != nil {
+	defer sm.mu.RUnlock()
+	if result := sm.DB.Where("token_hash = ?", hashToken(token)).First(&sess); result.Error != nil {
+		if gorm.IsRecordNotFoundError(result.Error) {
+			return nil, ErrNoAuth
+		}
 		return nil, result.Error
 	}
-	sm.mu.RUnlock()
 
 	return &sess, nil
 }
 
-func (sm *SessionsManager) Create(w http.ResponseWriter, token string, userID string, userLogin string) (*Session, error) {
-	sess := NewSession(userID, userLogin)
-	sess.Token = token
+// Create сохраняет сессию access-токена; cookie живет столько же, сколько сам токен.
+func (sm *SessionsManager) Create(ctx context.Context, w http.ResponseWriter, sess *Session) error {
+	_, span := tracer.Start(ctx, "session.Create")
+	defer span.End()
 	sm.mu.Lock()
-	if result := sm.DB.Create(sess); result.Error != nil {
-		return &Session{}, result.Error
-	}
-
+	err := sm.DB.Create(sess).Error
 	sm.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
 	cookie := &http.Cookie{
 		Name:    "token",
-		Value:   token,
-		Expires: time.Now().Add(90 * 24 * time.Hour),
+		Value:   sess.Token,
+		Expires: sess.ExpiresAt,
 		Path:    "/",
 	}
 	http.SetCookie(w, cookie)
-	return sess, nil
+	return nil
 }
 
 func (sm *SessionsManager) DestroyCurrent(w http.ResponseWriter, r *http.Request) error {
+	_, span := tracer.Start(r.Context(), "session.DestroyCurrent")
+	defer span.End()
 	sess, err := SessionFromContext(r.Context())
 	if err != nil {
 		return err
@@ -80,3 +81,87 @@ func (sm *SessionsManager) DestroyCurrent(w http.ResponseWriter, r *http.Request
 	http.SetCookie(w, &cookie)
 	return nil
 }
+
+func (sm *SessionsManager) UserSessions(ctx context.Context, userID string) ([]Session, error) {
+	_, span := tracer.Start(ctx, "session.UserSessions")
+	defer span.End()
+	var sessions []Session
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if result := sm.DB.Where("user_id = ?", userID).Find(&sessions); result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
+
+// DestroyUser завершает все сессии пользователя и отзывает его refresh-токены.
+func (sm *SessionsManager) DestroyUser(ctx context.Context, userID string) error {
+	_, span := tracer.Start(ctx, "session.DestroyUser")
+	defer span.End()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		return revokeWhere(tx, "user_id = ?", userID)
+	})
+}
+
+// Destroy завершает одну сессию вместе с ее семейством refresh-токенов - иначе
+// клиент получил бы новый access-токен по старому refresh.
+func (sm *SessionsManager) Destroy(ctx context.Context, token string) error {
+	_, span := tracer.Start(ctx, "session.Destroy")
+	defer span.End()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	var sess Session
+	if result := sm.DB.Where("token_hash = ?", hashToken(token)).First(&sess); result.Error != nil {
+		if gorm.IsRecordNotFoundError(result.Error) {
+			return nil
+		}
+		return result.Error
+	}
+	if sess.FamilyID == "" {
+		return sm.DB.Delete(&sess).Error
+	}
+	return sm.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeFamily(tx, sess.FamilyID)
+	})
+}
+
+func (sm *SessionsManager) All(ctx context.Context) ([]Session, error) {
+	_, span := tracer.Start(ctx, "session.All")
+	defer span.End()
+	var sessions []Session
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if result := sm.DB.Find(&sessions); result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
+
+func (sm *SessionsManager) Import(ctx context.Context, sess Session) error {
+	_, span := tracer.Start(ctx, "session.Import")
+	defer span.End()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.DB.Save(&sess).Error
+}
+
+// MigrateTokenHashes заполняет token_hash у сессий из старых файлов SQLite: AutoMigrate
+// добавляет колонку, но посчитать sha256 средствами SQLite нельзя. Для MySQL это делает миграция.
+func MigrateTokenHashes(db *gorm.DB) error {
+	var sessions []Session
+	if err := db.Where("token_hash IS NULL OR token_hash = ''").Find(&sessions).Error; err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		// token_hash - первичный ключ модели, gorm его не обновляет
+		if err := db.Exec("UPDATE sessions SET token_hash = ? WHERE token = ?", hashToken(s.Token), s.Token).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
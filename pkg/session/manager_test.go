@@ -0,0 +1,75 @@
+package session_test
+
+import (
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/storage"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Токен с подписью RS256 и kid занимает около 650 символов - больше прежнего VARCHAR(512).
+func TestLongToken(t *testing.T) {
+	sm := session.NewSessionsManager(openDB(t))
+	ctx := context.Background()
+	sess := session.NewSession("7", "alice", "", time.Now().Add(time.Hour))
+	sess.Token = strings.Repeat("a", 2000)
+	if err := sm.Create(ctx, httptest.NewRecorder(), sess); err != nil {
+		t.Fatal(err)
+	}
+	other := session.NewSession("7", "alice", "", time.Now().Add(time.Hour))
+	other.Token = strings.Repeat("a", 1999) + "b"
+	if err := sm.Create(ctx, httptest.NewRecorder(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := sm.Check(ctx, sess.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Token != sess.Token || got.TokenHash == "" {
+		t.Errorf("session = %+v", got)
+	}
+	if err = sm.Destroy(ctx, sess.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sm.Check(ctx, sess.Token); !errors.Is(err, session.ErrNoAuth) {
+		t.Errorf("after destroy: err = %v", err)
+	}
+	if _, err = sm.Check(ctx, other.Token); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+}
+
+// Файл SQLite со старой схемой, где ключом был сам токен, продолжает работать после AutoMigrate.
+func TestMigrateTokenHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := storage.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec("DROP TABLE sessions").Exec(`CREATE TABLE sessions (token varchar(255), login varchar(255),
+		user_id varchar(255), family_id varchar(255), is_active bool, created_at timestamp, expires_at timestamp,
+		PRIMARY KEY (token))`).Exec("INSERT INTO sessions (token, login, user_id, family_id) VALUES ('old-token', 'alice', '7', '')").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = storage.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sess, err := session.NewSessionsManager(db).Check(context.Background(), "old-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Login != "alice" {
+		t.Errorf("session = %+v", sess)
+	}
+}
@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+var (
+	ErrRefreshInvalid = errors.New("refresh token is invalid")
+	ErrRefreshExpired = errors.New("refresh token expired")
+	ErrRefreshReused  = errors.New("refresh token was already used")
+)
+
+// RefreshToken - одноразовый токен обновления. В базе лежит только sha256 от него:
+// утечка таблицы не дает готовых токенов. Все токены, полученные один из другого
+// начиная с входа, образуют семейство FamilyID.
+type RefreshToken struct {
+	TokenHash string `gorm:"primary_key"`
+	FamilyID  string `gorm:"index"`
+	UserID    string `gorm:"index"`
+	Login     string
+	CreatedAt time.Time `gorm:"type:timestamp"`
+	ExpiresAt time.Time `gorm:"type:timestamp"`
+	// UsedAt - когда токен обменяли на следующий
+	UsedAt    *time.Time `gorm:"type:timestamp"`
+	RevokedAt *time.Time `gorm:"type:timestamp"`
+}
+
+// NewFamilyID начинает новое семейство - при входе или регистрации.
+func NewFamilyID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashRefresh(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueRefresh выдает первый refresh-токен семейства.
+func (sm *SessionsManager) IssueRefresh(ctx context.Context, familyID, userID, login string, ttl time.Duration) (string, error) {
+	_, span := tracer.Start(ctx, "session.IssueRefresh")
+	defer span.End()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return issueRefresh(sm.DB, familyID, userID, login, ttl)
+}
+
+// Rotate обменивает refresh-токен на следующий в том же семействе. Повторное предъявление
+// уже обмененного токена значит, что он есть у двоих - у клиента и у того, кто его украл;
+// какой из них настоящий, не понять, поэтому семейство отзывается целиком вместе
+// с выпущенными из него access-токенами. Возвращает запись предъявленного токена.
+func (sm *SessionsManager) Rotate(ctx context.Context, raw string, ttl time.Duration) (*RefreshToken, string, error) {
+	_, span := tracer.Start(ctx, "session.Rotate")
+	defer span.End()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var old RefreshToken
+	if result := sm.DB.Where("token_hash = ?", hashRefresh(raw)).First(&old); result.Error != nil {
+		if gorm.IsRecordNotFoundError(result.Error) {
+			return nil, "", ErrRefreshInvalid
+		}
+		return nil, "", result.Error
+	}
+	now := time.Now()
+	switch {
+	case old.RevokedAt != nil:
+		return &old, "", ErrRefreshInvalid
+	case old.UsedAt != nil:
+		return &old, "", sm.revokeReused(old.FamilyID)
+	case now.After(old.ExpiresAt):
+		return &old, "", ErrRefreshExpired
+	}
+
+	var next string
+	err := sm.DB.Transaction(func(tx *gorm.DB) error {
+		// условие на used_at защищает от гонки двух инстансов с одним токеном
+		result := tx.Model(&RefreshToken{}).Where("token_hash = ? AND used_at IS NULL", old.TokenHash).Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshReused
+		}
+		// истекшие токены и сессии семейства больше не нужны даже для поиска повторов
+		if err := tx.Where("family_id = ? AND expires_at < ?", old.FamilyID, now).Delete(&RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("family_id = ? AND expires_at < ?", old.FamilyID, now).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		var err error
+		next, err = issueRefresh(tx, old.FamilyID, old.UserID, old.Login, ttl)
+		return err
+	})
+	if errors.Is(err, ErrRefreshReused) {
+		return &old, "", sm.revokeReused(old.FamilyID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &old, next, nil
+}
+
+// RevokeFamily отзывает семейство: refresh-токены и все выпущенные из него сессии.
+func (sm *SessionsManager) RevokeFamily(ctx context.Context, familyID string) error {
+	_, span := tracer.Start(ctx, "session.RevokeFamily")
+	defer span.End()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeFamily(tx, familyID)
+	})
+}
+
+func (sm *SessionsManager) revokeReused(familyID string) error {
+	err := sm.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeFamily(tx, familyID)
+	})
+	if err != nil {
+		return err
+	}
+	return ErrRefreshReused
+}
+
+func issueRefresh(db *gorm.DB, familyID, userID, login string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	token := RefreshToken{
+		TokenHash: hashRefresh(raw),
+		FamilyID:  familyID,
+		UserID:    userID,
+		Login:     login,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := db.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+func revokeFamily(tx *gorm.DB, familyID string) error {
+	if err := tx.Where("family_id = ?", familyID).Delete(&Session{}).Error; err != nil {
+		return err
+	}
+	return revokeWhere(tx, "family_id = ?", familyID)
+}
+
+func revokeWhere(tx *gorm.DB, query string, arg interface{}) error {
+	return tx.Model(&RefreshToken{}).Where(query+" AND revoked_at IS NULL", arg).Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,180 @@
+package session_test
+
+import (
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/storage"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// startFamily выдает refresh-токен и access-сессию нового семейства, как при входе.
+func startFamily(t *testing.T, sm *session.SessionsManager) (familyID, refresh, access string) {
+	t.Helper()
+	ctx := context.Background()
+	familyID, err := session.NewFamilyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err = sm.IssueRefresh(ctx, familyID, "7", "alice", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access = addSession(t, sm, familyID)
+	return familyID, refresh, access
+}
+
+func addSession(t *testing.T, sm *session.SessionsManager, familyID string) string {
+	t.Helper()
+	sess := session.NewSession("7", "alice", familyID, time.Now().Add(time.Hour))
+	sess.Token = familyID + "-" + time.Now().Format(time.RFC3339Nano)
+	if err := sm.Create(context.Background(), httptest.NewRecorder(), sess); err != nil {
+		t.Fatal(err)
+	}
+	return sess.Token
+}
+
+func TestRotate(t *testing.T) {
+	sm := session.NewSessionsManager(openDB(t))
+	ctx := context.Background()
+	familyID, refresh, _ := startFamily(t, sm)
+
+	old, next, err := sm.Rotate(ctx, refresh, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == "" || next == refresh || old.FamilyID != familyID || old.Login != "alice" {
+		t.Fatalf("rotate = %+v, %q", old, next)
+	}
+	// следующий токен того же семейства тоже обменивается
+	if _, _, err = sm.Rotate(ctx, next, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateReuseRevokesFamily(t *testing.T) {
+	sm := session.NewSessionsManager(openDB(t))
+	ctx := context.Background()
+	familyID, refresh, access := startFamily(t, sm)
+	_, next, err := sm.Rotate(ctx, refresh, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextAccess := addSession(t, sm, familyID)
+	_, otherRefresh, otherAccess := startFamily(t, sm)
+
+	old, _, err := sm.Rotate(ctx, refresh, time.Hour)
+	if !errors.Is(err, session.ErrRefreshReused) {
+		t.Fatalf("reuse: err = %v", err)
+	}
+	if old == nil || old.FamilyID != familyID {
+		t.Errorf("reuse returned %+v", old)
+	}
+
+	// отозван и честный токен, полученный при обмене, и все access-сессии семейства
+	if _, _, err = sm.Rotate(ctx, next, time.Hour); !errors.Is(err, session.ErrRefreshInvalid) {
+		t.Errorf("next after reuse: err = %v", err)
+	}
+	for _, token := range []string{access, nextAccess} {
+		if _, err = sm.Check(ctx, token); !errors.Is(err, session.ErrNoAuth) {
+			t.Errorf("session %s: err = %v", token, err)
+		}
+	}
+	// другое семейство того же пользователя не затронуто
+	if _, err = sm.Check(ctx, otherAccess); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+	if _, _, err = sm.Rotate(ctx, otherRefresh, time.Hour); err != nil {
+		t.Errorf("other family: %v", err)
+	}
+}
+
+func TestRotateErrors(t *testing.T) {
+	sm := session.NewSessionsManager(openDB(t))
+	ctx := context.Background()
+
+	if _, _, err := sm.Rotate(ctx, "unknown", time.Hour); !errors.Is(err, session.ErrRefreshInvalid) {
+		t.Errorf("unknown: err = %v", err)
+	}
+
+	familyID, err := session.NewFamilyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := sm.IssueRefresh(ctx, familyID, "7", "alice", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = sm.Rotate(ctx, expired, time.Hour); !errors.Is(err, session.ErrRefreshExpired) {
+		t.Errorf("expired: err = %v", err)
+	}
+
+	familyID, refresh, access := startFamily(t, sm)
+	if err = sm.RevokeFamily(ctx, familyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = sm.Rotate(ctx, refresh, time.Hour); !errors.Is(err, session.ErrRefreshInvalid) {
+		t.Errorf("revoked: err = %v", err)
+	}
+	if _, err = sm.Check(ctx, access); !errors.Is(err, session.ErrNoAuth) {
+		t.Errorf("revoked session: err = %v", err)
+	}
+}
+
+// Два инстанса (у каждого свой менеджер и мьютекс) одновременно обменивают один токен:
+// новый токен получает ровно один, остальные видят повтор.
+func TestRotateConcurrent(t *testing.T) {
+	db := openDB(t)
+	instances := []*session.SessionsManager{session.NewSessionsManager(db), session.NewSessionsManager(db)}
+	_, refresh, _ := startFamily(t, instances[0])
+
+	const n = 8
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		ok      int
+		reused  int
+		unknown []error
+	)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(sm *session.SessionsManager) {
+			defer wg.Done()
+			<-start
+			_, _, err := sm.Rotate(context.Background(), refresh, time.Hour)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ok++
+			case errors.Is(err, session.ErrRefreshReused), errors.Is(err, session.ErrRefreshInvalid):
+				// опоздавшие после отзыва семейства видят уже отозванный токен
+				reused++
+			default:
+				unknown = append(unknown, err)
+			}
+		}(instances[i%len(instances)])
+	}
+	close(start)
+	wg.Wait()
+
+	if ok != 1 || reused != n-1 || len(unknown) > 0 {
+		t.Errorf("ok = %d, reused = %d, other errors %v", ok, reused, unknown)
+	}
+}
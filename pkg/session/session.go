@@ -2,6 +2,8 @@ package session
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 )
@@ -12,16 +14,32 @@ func (s sqlTime) Time() (time.Time, error) {
 	return time.Parse("15:04:05", string(s))
 }
 
+// Session - сессия access-токена. Ключ - sha256 от токена: подписанный RSA токен
+// длиннее любого разумного VARCHAR, а у хеша длина постоянная.
 type Session struct {
-	Token     string `gorm:"primary_key"`
+	TokenHash string `gorm:"primary_key"`
+	Token     string `gorm:"type:text"`
 	Login     string
-	UserID    string
+	UserID    string `gorm:"index"`
+	// FamilyID связывает access-токен с цепочкой refresh-токенов, из которой он выпущен
+	FamilyID  string `gorm:"index"`
 	IsActive  bool
 	CreatedAt time.Time `gorm:"type:timestamp"`
 	ExpiresAt time.Time `gorm:"type:timestamp"`
 }
 
-func NewSession(userID string, userLogin string) *Session {
+// BeforeSave вызывает gorm: хеш всегда соответствует токену, в том числе при импорте из бэкапа.
+func (s *Session) BeforeSave() error {
+	s.TokenHash = hashToken(s.Token)
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewSession(userID, userLogin, familyID string, expiresAt time.Time) *Session {
 	// лучше генерировать из заданного алфавита, но так писать меньше и для учебного примера ОК
 	//randID := make([]byte, 16)
 	//_, err := rand.Read(randID)
@@ -31,8 +49,9 @@ func NewSession(userID string, userLogin string) *Session {
 	return &Session{
 		Login:     userLogin,
 		UserID:    userID,
+		FamilyID:  familyID,
 		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+		ExpiresAt: expiresAt,
 	}
 }
 
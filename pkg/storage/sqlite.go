@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"cmd/redditclone/pkg/account"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/user"
+	"database/sql"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	// драйвер на чистом Go: бинарник собирается с CGO_ENABLED=0
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite открывает (и при первом запуске создает) файл базы, в котором лежат
+// пользователи, сессии и посты, - для небольших инсталляций без MySQL и Mongo.
+func OpenSQLite(path string) (*gorm.DB, error) {
+	// _time_format=sqlite пишет время в том же формате, что и прежний cgo-драйвер,
+	// поэтому старые файлы базы читаются и сравниваются по датам как раньше
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite", path)
+	sqlDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite допускает одного писателя; одно соединение избавляет от SQLITE_BUSY
+	// и делает транзакции по голосам последовательными
+	sqlDB.SetMaxOpenConns(1)
+
+	// диалект sqlite3 встроен в gorm, драйвер ему передаем готовым пулом
+	db, err := gorm.Open("sqlite3", sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	if err = AutoMigrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create sqlite schema: %w", err)
+	}
+	return db, nil
+}
+
+// AutoMigrate создает недостающие таблицы и индексы. Для MySQL схемой управляют миграции из pkg/migrate.
+func AutoMigrate(db *gorm.DB) error {
+	err := db.AutoMigrate(&user.User{}, &session.Session{}, &session.RefreshToken{}, &account.Deletion{}).Error
+	if err != nil {
+		return err
+	}
+	if err = session.MigrateTokenHashes(db); err != nil {
+		return err
+	}
+	return posts.AutoMigrate(db)
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"cmd/redditclone/pkg/config"
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/session"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"time"
+)
+
+const connectTimeout = 10 * time.Second
+
+// Backend - все хранилища приложения. Пользователи, сессии и SQL-посты работают
+// через один пул соединений DB; Mongo открывается, только если посты лежат в ней.
+type Backend struct {
+	DB       *gorm.DB
+	Mongo    *mongo.Client
+	Users    *user.UserMemoryRepository
+	Sessions *session.SessionsManager
+	Items    posts.ItemsRepo
+}
+
+func Open(ctx context.Context, cfg config.Storage) (*Backend, error) {
+	b := &Backend{}
+	var err error
+	switch cfg.Kind {
+	case "sqlite":
+		b.DB, err = OpenSQLite(cfg.SQLitePath)
+	default:
+		b.DB, err = OpenMySQL(ctx, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.Users = user.NewUserMemoryRepo(b.DB)
+	b.Sessions = session.NewSessionsManager(b.DB)
+
+	if cfg.Kind == "mysql" && cfg.Posts == "mongo" {
+		if b.Mongo, err = OpenMongo(ctx, cfg.MongoURI); err != nil {
+			b.DB.Close()
+			return nil, err
+		}
+		b.Items = posts.NewMemoryRepo(b.Mongo, cfg.MongoDatabase)
+	} else {
+		// для MySQL таблицы постов создает миграция 0005_create_posts
+		b.Items = posts.NewSQLRepo(b.DB)
+	}
+	return b, nil
+}
+
+func OpenMySQL(ctx context.Context, cfg config.Storage) (*gorm.DB, error) {
+	db, err := gorm.Open("mysql", cfg.MySQLDSN)
+	if err != nil {
+		return nil, fmt.Errorf("connect mysql: %w", err)
+	}
+	db.DB().SetMaxOpenConns(cfg.MaxOpenConns)
+	db.DB().SetMaxIdleConns(cfg.MaxIdleConns)
+	db.DB().SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	if err = db.DB().PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping mysql: %w", err)
+	}
+	return db, nil
+}
+
+func OpenMongo(ctx context.Context, uri string) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	// монитор пишет спан на каждую команду Mongo внутри спана репозитория
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(otelmongo.NewMonitor()))
+	if err != nil {
+		return nil, fmt.Errorf("connect mongo: %w", err)
+	}
+	if err = client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("ping mongo: %w", err)
+	}
+	return client, nil
+}
+
+// Close закрывает клиентов баз; вызывать после остановки HTTP-сервера и фоновых задач.
+func (b *Backend) Close(ctx context.Context) error {
+	var errs []error
+	if b.Mongo != nil {
+		if err := b.Mongo.Disconnect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("disconnect mongo: %w", err))
+		}
+	}
+	if err := b.DB.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close database: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"net/http"
+)
+
+// Middleware открывает серверный спан на каждый запрос, продолжая трассу из заголовка
+// traceparent. Спан называется по шаблону маршрута mux, как и метки в metrics.Middleware.
+func Middleware(router *mux.Router, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.request",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			var match mux.RouteMatch
+			if router.Match(r, &match) && match.Route != nil {
+				if tpl, err := match.Route.GetPathTemplate(); err == nil {
+					return r.Method + " " + tpl
+				}
+			}
+			return r.Method
+		}),
+		// /metrics и пробы дергаются постоянно и засоряют трассы
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/metrics", "/healthz", "/readyz":
+				return false
+			}
+			return true
+		}),
+	)
+}
@@ -0,0 +1,239 @@
+package tracing
+
+import (
+	"cmd/redditclone/pkg/posts"
+	"cmd/redditclone/pkg/user"
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+var tracer = otel.Tracer("cmd/redditclone/pkg/tracing")
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ItemsRepo открывает спан на каждый вызов репозитория постов. System (mongodb, mysql, sqlite)
+// пишется в атрибут db.system, чтобы по трассе было видно, в какую базу ушло время.
+type ItemsRepo struct {
+	Repo   posts.ItemsRepo
+	System string
+}
+
+func NewItemsRepo(repo posts.ItemsRepo, system string) *ItemsRepo {
+	return &ItemsRepo{Repo: repo, System: system}
+}
+
+func (r *ItemsRepo) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "posts."+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", r.System)))
+}
+
+func (r *ItemsRepo) GetAll(ctx context.Context) []*posts.Post {
+	ctx, span := r.start(ctx, "GetAll")
+	defer span.End()
+	return r.Repo.GetAll(ctx)
+}
+
+func (r *ItemsRepo) AddPost(ctx context.Context, post *posts.PostToFront) {
+	ctx, span := r.start(ctx, "AddPost")
+	defer span.End()
+	r.Repo.AddPost(ctx, post)
+}
+
+func (r *ItemsRepo) AddComment(ctx context.Context, postID string, comment posts.Comment) *posts.Post {
+	ctx, span := r.start(ctx, "AddComment")
+	defer span.End()
+	return r.Repo.AddComment(ctx, postID, comment)
+}
+
+func (r *ItemsRepo) DeleteComment(ctx context.Context, postID string, commentID string) *posts.Post {
+	ctx, span := r.start(ctx, "DeleteComment")
+	defer span.End()
+	return r.Repo.DeleteComment(ctx, postID, commentID)
+}
+
+func (r *ItemsRepo) DeletePost(ctx context.Context, id string) {
+	ctx, span := r.start(ctx, "DeletePost")
+	defer span.End()
+	r.Repo.DeletePost(ctx, id)
+}
+
+func (r *ItemsRepo) AddVote(ctx context.Context, postID string, userID string, vote posts.Vote) *posts.Post {
+	ctx, span := r.start(ctx, "AddVote")
+	defer span.End()
+	return r.Repo.AddVote(ctx, postID, userID, vote)
+}
+
+func (r *ItemsRepo) DeleteVote(ctx context.Context, postID string, userID string) *posts.Post {
+	ctx, span := r.start(ctx, "DeleteVote")
+	defer span.End()
+	return r.Repo.DeleteVote(ctx, postID, userID)
+}
+
+func (r *ItemsRepo) FindPost(ctx context.Context, postID string) (*posts.Post, bool) {
+	ctx, span := r.start(ctx, "FindPost")
+	defer span.End()
+	return r.Repo.FindPost(ctx, postID)
+}
+
+func (r *ItemsRepo) AddDraft(ctx context.Context, post *posts.PostToFront, publishAt *time.Time) {
+	ctx, span := r.start(ctx, "AddDraft")
+	defer span.End()
+	r.Repo.AddDraft(ctx, post, publishAt)
+}
+
+func (r *ItemsRepo) GetDrafts(ctx context.Context, authorID string) []*posts.Post {
+	ctx, span := r.start(ctx, "GetDrafts")
+	defer span.End()
+	return r.Repo.GetDrafts(ctx, authorID)
+}
+
+func (r *ItemsRepo) UpdateDraft(ctx context.Context, post *posts.Post) bool {
+	ctx, span := r.start(ctx, "UpdateDraft")
+	defer span.End()
+	return r.Repo.UpdateDraft(ctx, post)
+}
+
+func (r *ItemsRepo) SetDraftSchedule(ctx context.Context, postID string, publishAt *time.Time) (*posts.Post, bool) {
+	ctx, span := r.start(ctx, "SetDraftSchedule")
+	defer span.End()
+	return r.Repo.SetDraftSchedule(ctx, postID, publishAt)
+}
+
+func (r *ItemsRepo) PublishDraft(ctx context.Context, postID string, now time.Time) (*posts.Post, bool) {
+	ctx, span := r.start(ctx, "PublishDraft")
+	defer span.End()
+	return r.Repo.PublishDraft(ctx, postID, now)
+}
+
+func (r *ItemsRepo) PublishDue(ctx context.Context, now time.Time) []*posts.Post {
+	ctx, span := r.start(ctx, "PublishDue")
+	defer span.End()
+	return r.Repo.PublishDue(ctx, now)
+}
+
+func (r *ItemsRepo) ArchiveOlderThan(ctx context.Context, category string, before time.Time) (int, error) {
+	ctx, span := r.start(ctx, "ArchiveOlderThan")
+	res, err := r.Repo.ArchiveOlderThan(ctx, category, before)
+	end(span, err)
+	return res, err
+}
+
+func (r *ItemsRepo) ReplaceAuthor(ctx context.Context, authorID string, replacement posts.Author) error {
+	ctx, span := r.start(ctx, "ReplaceAuthor")
+	err := r.Repo.ReplaceAuthor(ctx, authorID, replacement)
+	end(span, err)
+	return err
+}
+
+func (r *ItemsRepo) DeleteByAuthor(ctx context.Context, authorID string) error {
+	ctx, span := r.start(ctx, "DeleteByAuthor")
+	err := r.Repo.DeleteByAuthor(ctx, authorID)
+	end(span, err)
+	return err
+}
+
+func (r *ItemsRepo) AllPosts(ctx context.Context) []*posts.Post {
+	ctx, span := r.start(ctx, "AllPosts")
+	defer span.End()
+	return r.Repo.AllPosts(ctx)
+}
+
+func (r *ItemsRepo) SetRemoved(ctx context.Context, postID string, removed bool) (*posts.Post, bool) {
+	ctx, span := r.start(ctx, "SetRemoved")
+	defer span.End()
+	return r.Repo.SetRemoved(ctx, postID, removed)
+}
+
+func (r *ItemsRepo) RecountVotes(ctx context.Context, postID string) (*posts.Post, bool) {
+	ctx, span := r.start(ctx, "RecountVotes")
+	defer span.End()
+	return r.Repo.RecountVotes(ctx, postID)
+}
+
+func (r *ItemsRepo) ImportPost(ctx context.Context, post *posts.Post) error {
+	ctx, span := r.start(ctx, "ImportPost")
+	err := r.Repo.ImportPost(ctx, post)
+	end(span, err)
+	return err
+}
+
+// UserRepo - то же для пользователей; методы без обращения к базе проходят насквозь.
+type UserRepo struct {
+	user.UserRepo
+	System string
+}
+
+func NewUserRepo(repo user.UserRepo, system string) *UserRepo {
+	return &UserRepo{UserRepo: repo, System: system}
+}
+
+func (r *UserRepo) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "users."+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", r.System)))
+}
+
+func (r *UserRepo) Authorize(ctx context.Context, login, pass string) (user.User, error) {
+	ctx, span := r.start(ctx, "Authorize")
+	res, err := r.UserRepo.Authorize(ctx, login, pass)
+	end(span, err)
+	return res, err
+}
+
+func (r *UserRepo) SignUp(ctx context.Context, login, pass string) (user.User, error) {
+	ctx, span := r.start(ctx, "SignUp")
+	res, err := r.UserRepo.SignUp(ctx, login, pass)
+	end(span, err)
+	return res, err
+}
+
+func (r *UserRepo) GetUser(ctx context.Context, login string) (user.User, error) {
+	ctx, span := r.start(ctx, "GetUser")
+	res, err := r.UserRepo.GetUser(ctx, login)
+	end(span, err)
+	return res, err
+}
+
+func (r *UserRepo) Delete(ctx context.Context, login string) error {
+	ctx, span := r.start(ctx, "Delete")
+	err := r.UserRepo.Delete(ctx, login)
+	end(span, err)
+	return err
+}
+
+func (r *UserRepo) List(ctx context.Context, search string) ([]user.User, error) {
+	ctx, span := r.start(ctx, "List")
+	res, err := r.UserRepo.List(ctx, search)
+	end(span, err)
+	return res, err
+}
+
+func (r *UserRepo) SetPassword(ctx context.Context, login, pass string) error {
+	ctx, span := r.start(ctx, "SetPassword")
+	err := r.UserRepo.SetPassword(ctx, login, pass)
+	end(span, err)
+	return err
+}
+
+func (r *UserRepo) SetSuspended(ctx context.Context, login string, suspended bool) error {
+	ctx, span := r.start(ctx, "SetSuspended")
+	err := r.UserRepo.SetSuspended(ctx, login, suspended)
+	end(span, err)
+	return err
+}
+
+func (r *UserRepo) Import(ctx context.Context, u user.User) error {
+	ctx, span := r.start(ctx, "Import")
+	err := r.UserRepo.Import(ctx, u)
+	end(span, err)
+	return err
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"cmd/redditclone/pkg/config"
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"os"
+)
+
+const serviceName = "redditclone"
+
+// Setup настраивает глобальные TracerProvider и пропагатор W3C traceparent.
+// С exporter none спаны не пишутся, но входящий traceparent все равно принимается,
+// и его trace_id попадает в логи. Возвращаемая функция дописывает буфер спанов.
+func Setup(cfg config.Tracing) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var out io.Writer
+	var file *os.File
+	switch cfg.Exporter {
+	case "none":
+		return func(ctx context.Context) error { return nil }, nil
+	case "stdout":
+		out = os.Stdout
+	case "file":
+		var err error
+		if file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		out = file
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		// решение входящего traceparent уважается, свои трассы - с заданной долей
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Fields - поля trace_id и span_id для zap-логгера, пустые, если контекст не в трассе.
+func Fields(ctx context.Context) []interface{} {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []interface{}{"trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String()}
+}
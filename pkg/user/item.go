@@ -1,18 +1,28 @@
 package user
 
-import "cmd/redditclone/pkg/posts"
+import (
+	"cmd/redditclone/pkg/posts"
+	"context"
+)
 
 type User struct {
 	ID        int    `gorm:"primary_key"`
-	Login     string ``
+	Login     string `gorm:"unique_index"`
 	Password  string
+	Suspended bool
 	userPosts map[string]bool        // save PostID
 	votes     map[string]*posts.Vote // [postID]voteValue
 }
 
 type UserRepo interface {
-	Authorize(login, pass string) (User, error)
-	SignUp(login, pass string) (User, error)
+	Authorize(ctx context.Context, login, pass string) (User, error)
+	SignUp(ctx context.Context, login, pass string) (User, error)
+	GetUser(ctx context.Context, login string) (User, error)
+	Delete(ctx context.Context, login string) error
+	List(ctx context.Context, search string) ([]User, error)
+	SetPassword(ctx context.Context, login, pass string) error
+	SetSuspended(ctx context.Context, login string, suspended bool) error
+	Import(ctx context.Context, user User) error
 	AddPost(login, postID string) error
 	DeletePost(login, postID string) error
 	AddVote(login, postID string, vote *posts.Vote) error
@@ -2,27 +2,33 @@ package user
 
 import (
 	"cmd/redditclone/pkg/posts"
+	"context"
+	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/crypto/bcrypt"
 	"sync"
 )
 
+var tracer = otel.Tracer("cmd/redditclone/pkg/user")
+
+var (
+	ErrSuspended = errors.New("аккаунт заблокирован")
+	// ErrBadCredentials не различает неизвестный логин и неверный пароль - чтобы не выдавать, какие логины заняты
+	ErrBadCredentials = errors.New("неверный логин или пароль")
+	ErrExists         = errors.New("пользователь с таким логином уже существует")
+)
+
 type UserMemoryRepository struct {
 	DB   *gorm.DB
 	data map[string]*User
 	mu   sync.RWMutex
 }
 
-func NewUserMemoryRepo() *UserMemoryRepository {
-	dsn := "root:@tcp(localhost:3306)/reddit_clone"
-	db, err := gorm.Open("mysql", dsn)
-	if err != nil {
-		panic(err)
-	}
-	db.DB()
-	db.DB().Ping()
+// NewUserMemoryRepo - репозиторий поверх общего пула соединений (MySQL или SQLite).
+func NewUserMemoryRepo(db *gorm.DB) *UserMemoryRepository {
 	return &UserMemoryRepository{
 		DB:   db,
 		data: map[string]*User{},
@@ -30,27 +36,40 @@ func NewUserMemoryRepo() *UserMemoryRepository {
 	}
 }
 
-func (repo *UserMemoryRepository) Authorize(login, pass string) (User, error) {
+func (repo *UserMemoryRepository) Authorize(ctx context.Context, login, pass string) (User, error) {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
 	var user User
 	if result := repo.DB.Where("login = ?", login).First(&user); result.Error != nil {
+		if gorm.IsRecordNotFoundError(result.Error) {
+			return User{}, ErrBadCredentials
+		}
 		return User{}, result.Error
 	}
 
-	if !CheckPasswordHash(pass, user.Password) {
-		return User{}, fmt.Errorf("неверный логин или пароль")
+	if !CheckPasswordHash(ctx, pass, user.Password) {
+		return User{}, ErrBadCredentials
+	}
+	if user.Suspended {
+		return User{}, ErrSuspended
 	}
 
 	return user, nil
 }
 
-func (repo *UserMemoryRepository) SignUp(login, pass string) (User, error) {
+func (repo *UserMemoryRepository) SignUp(ctx context.Context, login, pass string) (User, error) {
 
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
 
-	hashedPassword, err := HashPassword(pass)
+	var count int
+	if result := repo.DB.Model(&User{}).Where("login = ?", login).Count(&count); result.Error != nil {
+		return User{}, result.Error
+	}
+	if count > 0 {
+		return User{}, ErrExists
+	}
+	hashedPassword, err := HashPassword(ctx, pass)
 	if err != nil {
 		return User{}, err
 	}
@@ -61,64 +80,133 @@ func (repo *UserMemoryRepository) SignUp(login, pass string) (User, error) {
 	return user, nil
 }
 
-func (repo *UserMemoryRepository) AddPost(login, postID string) error {
+func (repo *UserMemoryRepository) GetUser(ctx context.Context, login string) (User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	var user User
+	if result := repo.DB.Where("login = ?", login).First(&user); result.Error != nil {
+		return User{}, result.Error
+	}
+	return user, nil
+}
+
+func (repo *UserMemoryRepository) Delete(ctx context.Context, login string) error {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
-	if _, ok := repo.data[login]; !ok {
-		return fmt.Errorf("пользователь с таким именем уже существует %s", login)
+	if result := repo.DB.Where("login = ?", login).Delete(&User{}); result.Error != nil {
+		return result.Error
 	}
-	repo.data[login].userPosts[postID] = true
+	delete(repo.data, login)
 	return nil
 }
 
-func (repo *UserMemoryRepository) DeletePost(login, postID string) error {
+// List возвращает пользователей, в логине которых есть search; пустой search - всех.
+func (repo *UserMemoryRepository) List(ctx context.Context, search string) ([]User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	var users []User
+	query := repo.DB.Order("id")
+	if search != "" {
+		query = query.Where("login LIKE ?", "%"+search+"%")
+	}
+	if result := query.Find(&users); result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+func (repo *UserMemoryRepository) SetPassword(ctx context.Context, login, pass string) error {
+	hashedPassword, err := HashPassword(ctx, pass)
+	if err != nil {
+		return err
+	}
+	return repo.updateUser(ctx, login, "password", hashedPassword)
+}
+
+func (repo *UserMemoryRepository) SetSuspended(ctx context.Context, login string, suspended bool) error {
+	return repo.updateUser(ctx, login, "suspended", suspended)
+}
+
+// Import сохраняет пользователя как есть - с его ID и хешем пароля; существующая запись перезаписывается.
+func (repo *UserMemoryRepository) Import(ctx context.Context, user User) error {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
+	return repo.DB.Save(&user).Error
+}
 
-	if _, ok := repo.data[login]; !ok {
-		return fmt.Errorf("пользователь с таким именем уже существует %s", login)
+func (repo *UserMemoryRepository) updateUser(ctx context.Context, login, column string, value interface{}) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	var user User
+	if result := repo.DB.Where("login = ?", login).First(&user); result.Error != nil {
+		return fmt.Errorf("пользователь %s не найден: %w", login, result.Error)
+	}
+	return repo.DB.Model(&user).Update(column, value).Error
+}
+
+// entry возвращает посты и голоса пользователя в памяти процесса, создавая их при первом
+// обращении: после рестарта записей нет ни у кого. Вызывается под repo.mu.
+func (repo *UserMemoryRepository) entry(login string) *User {
+	u, ok := repo.data[login]
+	if !ok {
+		u = &User{Login: login, userPosts: map[string]bool{}, votes: map[string]*posts.Vote{}}
+		repo.data[login] = u
 	}
-	repo.data[login].userPosts[postID] = false
+	return u
+}
+
+func (repo *UserMemoryRepository) AddPost(login, postID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.entry(login).userPosts[postID] = true
 	return nil
 }
 
-func (repo *UserMemoryRepository) AddVote(login, postID string, vote *posts.Vote) error {
+func (repo *UserMemoryRepository) DeletePost(login, postID string) error {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
-	if _, ok := repo.data[login]; !ok {
-		return fmt.Errorf("пользователь с таким именем уже существует %s", login)
+	if u, ok := repo.data[login]; ok {
+		delete(u.userPosts, postID)
 	}
-	repo.data[login].votes[postID] = vote
+	return nil
+}
+
+func (repo *UserMemoryRepository) AddVote(login, postID string, vote *posts.Vote) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.entry(login).votes[postID] = vote
 	return nil
 }
 
 func (repo *UserMemoryRepository) SetVote(login, postID string, voteValue int) error {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
-	if _, ok := repo.data[login]; !ok {
-		return fmt.Errorf("пользователь с таким именем уже существует %s", login)
+	vote, ok := repo.entry(login).votes[postID]
+	if !ok {
+		return fmt.Errorf("голос пользователя %s за пост %s не найден", login, postID)
 	}
-	repo.data[login].votes[postID].Vote = voteValue
+	vote.Vote = voteValue
 	return nil
 }
 
 func (repo *UserMemoryRepository) DeleteVote(login, postID string) error {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
-	if _, ok := repo.data[login]; !ok {
-		return fmt.Errorf("пользователь с таким именем уже существует %s", login)
+	if u, ok := repo.data[login]; ok {
+		delete(u.votes, postID)
 	}
-	delete(repo.data[login].votes, postID)
 	return nil
 }
 
 func (repo *UserMemoryRepository) GetUserPosts(login string) []string {
 	repo.mu.RLock()
-	postsSeq := repo.data[login].userPosts
-	repo.mu.RUnlock()
-
-	posts := make([]string, len(postsSeq))
-	for post := range postsSeq {
+	defer repo.mu.RUnlock()
+	u, ok := repo.data[login]
+	if !ok {
+		return []string{}
+	}
+	posts := make([]string, 0, len(u.userPosts))
+	for post := range u.userPosts {
 		posts = append(posts, post)
 	}
 	return posts
@@ -126,11 +214,13 @@ func (repo *UserMemoryRepository) GetUserPosts(login string) []string {
 
 func (repo *UserMemoryRepository) GetUserVotes(login string) []string {
 	repo.mu.RLock()
-	votesSeq := repo.data[login].votes
-	repo.mu.RUnlock()
-
-	votes := make([]string, len(votesSeq))
-	for vote := range votesSeq {
+	defer repo.mu.RUnlock()
+	u, ok := repo.data[login]
+	if !ok {
+		return []string{}
+	}
+	votes := make([]string, 0, len(u.votes))
+	for vote := range u.votes {
 		votes = append(votes, vote)
 	}
 	return votes
@@ -139,19 +229,28 @@ func (repo *UserMemoryRepository) GetUserVotes(login string) []string {
 func (repo *UserMemoryRepository) GetVote(login, postID string) int {
 	repo.mu.RLock()
 	defer repo.mu.RUnlock()
-	vote, ok := repo.data[login].votes[postID]
+	u, ok := repo.data[login]
 	if !ok {
 		return 0
 	}
+	vote, ok := u.votes[postID]
+	if !ok || vote == nil {
+		return 0
+	}
 	return vote.Vote
 }
 
-func HashPassword(password string) (string, error) {
+// HashPassword и CheckPasswordHash пишут отдельные спаны: bcrypt - заметная часть времени входа и регистрации.
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracer.Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
 }
 
-func CheckPasswordHash(password, hash string) bool {
+func CheckPasswordHash(ctx context.Context, password, hash string) bool {
+	_, span := tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
@@ -0,0 +1,150 @@
+package validate
+
+import (
+	"cmd/redditclone/pkg/apierr"
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Тексты ошибок совпадают с проверками форм во фронтенде. Исключение - длины: фронтенд пишет
+// "less than n", хотя n символов допустимо, поэтому здесь границы названы точно.
+
+// Rule проверяет значение поля и возвращает текст ошибки или "".
+type Rule func(value string) string
+
+// Validatable реализуют DTO запросов.
+type Validatable interface {
+	Validate() error
+}
+
+// Normalizer приводит DTO к каноническому виду до проверки.
+type Normalizer interface {
+	Normalize()
+}
+
+// Validator собирает ошибки по полям; на каждое поле - только первая.
+type Validator struct {
+	fields []apierr.FieldError
+}
+
+func (v *Validator) Field(param, value string, rules ...Rule) {
+	v.check(param, value, value, rules)
+}
+
+// Secret - как Field, но значение не попадает в ответ.
+func (v *Validator) Secret(param, value string, rules ...Rule) {
+	v.check(param, value, nil, rules)
+}
+
+func (v *Validator) check(param, value string, shown interface{}, rules []Rule) {
+	if msg := Check(value, rules...); msg != "" {
+		v.fields = append(v.fields, apierr.Field(param, msg, shown))
+	}
+}
+
+// Check возвращает первую ошибку значения или "" - для проверок вне HTTP, например в redditadmin.
+func Check(value string, rules ...Rule) string {
+	for _, rule := range rules {
+		if msg := rule(value); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// Err возвращает apierr.Validation со всеми ошибками или nil.
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return apierr.Validation(v.fields...)
+}
+
+// Password - правила для нового пароля, одинаковые при регистрации и сбросе администратором.
+// Больше 72 байт bcrypt молча обрезал бы.
+func Password() []Rule {
+	return []Rule{Required, MinLen(8), MaxBytes(72)}
+}
+
+func Required(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "required"
+	}
+	return ""
+}
+
+// Empty - поле не должно быть заполнено (например, text у поста-ссылки).
+func Empty(value string) string {
+	if value != "" {
+		return "must be empty"
+	}
+	return ""
+}
+
+// HTTPURL - абсолютная http(s)-ссылка с хостом.
+func HTTPURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "must be a valid http or https url"
+	}
+	return ""
+}
+
+// MaxLen и MinLen считают символы, а не байты; граница n входит в допустимые значения.
+func MaxLen(n int) Rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+		return ""
+	}
+}
+
+func MinLen(n int) Rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) < n {
+			return fmt.Sprintf("must be at least %d characters", n)
+		}
+		return ""
+	}
+}
+
+// MaxBytes нужен там, где лимит задан в байтах: bcrypt учитывает только первые 72.
+func MaxBytes(n int) Rule {
+	return func(value string) string {
+		if len(value) > n {
+			return fmt.Sprintf("must be at most %d bytes", n)
+		}
+		return ""
+	}
+}
+
+func OneOf(allowed ...string) Rule {
+	return func(value string) string {
+		for _, a := range allowed {
+			if value == a {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(allowed, ", ")
+	}
+}
+
+func Matches(re *regexp.Regexp, msg string) Rule {
+	return func(value string) string {
+		if !re.MatchString(value) {
+			return msg
+		}
+		return ""
+	}
+}
+
+// Username приводит логин к NFKC: полноширинные и прочие совместимые формы
+// символов совпадают с обычными, и "ａｌｉｃｅ" не зарегистрировать рядом с "alice".
+func Username(login string) string {
+	return norm.NFKC.String(login)
+}
@@ -0,0 +1,112 @@
+package validate
+
+import (
+	"cmd/redditclone/pkg/apierr"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		value string
+		want  string
+	}{
+		{"required ok", Required, "x", ""},
+		{"required empty", Required, "", "required"},
+		{"required spaces", Required, " \t", "required"},
+		{"empty ok", Empty, "", ""},
+		{"empty filled", Empty, "x", "must be empty"},
+		{"http url", HTTPURL, "https://example.com/a", ""},
+		{"url without host", HTTPURL, "https:///a", "must be a valid http or https url"},
+		{"url bad scheme", HTTPURL, "javascript:alert(1)", "must be a valid http or https url"},
+		{"relative url", HTTPURL, "/a", "must be a valid http or https url"},
+		{"max len at limit", MaxLen(3), "abc", ""},
+		{"max len over", MaxLen(3), "abcd", "must be at most 3 characters"},
+		{"max len counts runes", MaxLen(3), "абв", ""},
+		{"min len at limit", MinLen(3), "abc", ""},
+		{"min len under", MinLen(3), "ab", "must be at least 3 characters"},
+		{"min len counts runes", MinLen(3), "аб", "must be at least 3 characters"},
+		{"max bytes at limit", MaxBytes(4), "абв"[:4], ""},
+		{"max bytes over", MaxBytes(4), "абв", "must be at most 4 bytes"},
+		{"one of ok", OneOf("link", "text"), "text", ""},
+		{"one of bad", OneOf("link", "text"), "video", "must be one of: link, text"},
+		{"matches ok", Matches(regexp.MustCompile(`^[a-z]+$`), "bad"), "abc", ""},
+		{"matches bad", Matches(regexp.MustCompile(`^[a-z]+$`), "bad"), "ab1", "bad"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule(tt.value); got != tt.want {
+				t.Errorf("rule(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		password, want string
+	}{
+		{"", "required"},
+		{"short", "must be at least 8 characters"},
+		{"password1", ""},
+		{strings.Repeat("я", 36), ""},
+		{strings.Repeat("я", 37), "must be at most 72 bytes"},
+	}
+	for _, tt := range tests {
+		if got := Check(tt.password, Password()...); got != tt.want {
+			t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestValidator(t *testing.T) {
+	var v Validator
+	if v.Err() != nil {
+		t.Fatal("empty validator returned an error")
+	}
+	v.Field("title", "", Required, MaxLen(3))
+	v.Field("url", "https://example.com", Required, HTTPURL)
+	v.Secret("password", "short", Required, MinLen(8))
+
+	var apiErr *apierr.Error
+	if !errors.As(v.Err(), &apiErr) {
+		t.Fatalf("Err() = %v", v.Err())
+	}
+	if apiErr.Code != apierr.CodeValidation || len(apiErr.Fields) != 2 {
+		t.Fatalf("error = %+v", apiErr)
+	}
+	// на поле - только первая ошибка
+	if f := apiErr.Fields[0]; f.Param != "title" || f.Msg != "required" || f.Value != "" {
+		t.Errorf("title = %+v", f)
+	}
+	if f := apiErr.Fields[1]; f.Param != "password" || f.Value != nil {
+		t.Errorf("password = %+v", f)
+	}
+}
+
+func TestUsername(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"ａｌｉｃｅ", "alice"},
+		{"ＡＬＩＣＥ_１", "ALICE_1"},
+		{"ﬁsh", "fish"},
+		{"bob²", "bob2"},
+		{"Zoe\u0308", "Zoë"},
+		{"Zoë", "Zoë"},
+	}
+	for _, tt := range tests {
+		if got := Username(tt.in); got != tt.want {
+			t.Errorf("Username(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	// после свертки логин проходит те же проверки, что и обычный
+	if got := Username("ａｌｉｃｅ"); strings.ContainsFunc(got, func(r rune) bool { return r > 0x7f }) {
+		t.Errorf("fullwidth login not folded to ASCII: %q", got)
+	}
+}